@@ -0,0 +1,280 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+// Package bench provides standardized workloads to benchmark htree and its
+// variants, so performance regressions are measurable across releases.
+//
+// Example:
+//
+//	func BenchmarkHTree(b *testing.B) {
+//		for _, w := range bench.Standard(1<<20, 1) {
+//			b.Run(w.Name, func(b *testing.B) {
+//				bench.Benchmark(b, htree.New(), w)
+//			})
+//		}
+//	}
+package bench // import "github.com/hit9/htree/bench"
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/hit9/htree"
+)
+
+// Tree is the interface of the containers under benchmark, implemented by
+// htree.HTree.
+type Tree interface {
+	Get(item htree.Item) htree.Item
+	Put(item htree.Item) htree.Item
+	Delete(item htree.Item) htree.Item
+}
+
+// Op is the type of an operation in a workload.
+type Op uint8
+
+// Operations.
+const (
+	OpGet Op = iota
+	OpPut
+	OpDelete
+)
+
+// Workload is a sequence of operations on items.
+type Workload struct {
+	Name  string
+	Items []htree.Item // items of the operations
+	Ops   []Op         // operations, same length with Items
+}
+
+// Uniform returns n uniformly distributed keys.
+func Uniform(n int, r *rand.Rand) []uint32 {
+	keys := make([]uint32, n)
+	for i := range keys {
+		keys[i] = r.Uint32()
+	}
+	return keys
+}
+
+// Zipfian returns n keys following the zipfian distribution, a few keys
+// are very hot.
+func Zipfian(n int, r *rand.Rand) []uint32 {
+	z := rand.NewZipf(r, 1.1, 1, math.MaxUint32)
+	keys := make([]uint32, n)
+	for i := range keys {
+		keys[i] = uint32(z.Uint64())
+	}
+	return keys
+}
+
+// Sequential returns n consecutive keys starting from 0.
+func Sequential(n int) []uint32 {
+	keys := make([]uint32, n)
+	for i := range keys {
+		keys[i] = uint32(i)
+	}
+	return keys
+}
+
+// Multiple of the first 6 primes, keys divisible by it share the same
+// remainders on the first 6 depths.
+const skew = 2 * 3 * 5 * 7 * 11 * 13
+
+// ResidueSkewed returns n adversarial keys sharing the same remainders on
+// the first 6 depths, which forces deep paths in the htree.
+func ResidueSkewed(n int, r *rand.Rand) []uint32 {
+	keys := make([]uint32, n)
+	for i := range keys {
+		keys[i] = uint32(r.Int63n(math.MaxUint32/skew+1)) * skew
+	}
+	return keys
+}
+
+// NewWorkload creates a workload operating on the keys in order, reads take
+// the given ratio of the operations, and writes are evenly split into puts
+// and deletes.
+func NewWorkload(name string, keys []uint32, readRatio float64, r *rand.Rand) *Workload {
+	w := &Workload{
+		Name:  name,
+		Items: make([]htree.Item, len(keys)),
+		Ops:   make([]Op, len(keys)),
+	}
+	for i, key := range keys {
+		w.Items[i] = htree.Uint32(key)
+		switch f := r.Float64(); {
+		case f < readRatio:
+			w.Ops[i] = OpGet
+		case f < readRatio+(1-readRatio)/2:
+			w.Ops[i] = OpPut
+		default:
+			w.Ops[i] = OpDelete
+		}
+	}
+	return w
+}
+
+// Standard returns the standard workloads of n operations: uniform,
+// zipfian, sequential and residue skewed keys, each with 50%, 90% and 99%
+// reads.
+func Standard(n int, seed int64) []*Workload {
+	r := rand.New(rand.NewSource(seed))
+	dists := []struct {
+		name string
+		keys []uint32
+	}{
+		{"uniform", Uniform(n, r)},
+		{"zipfian", Zipfian(n, r)},
+		{"sequential", Sequential(n)},
+		{"skewed", ResidueSkewed(n, r)},
+	}
+	var workloads []*Workload
+	for _, dist := range dists {
+		for _, reads := range []int{50, 90, 99} {
+			name := fmt.Sprintf("%s-r%d", dist.name, reads)
+			workloads = append(workloads, NewWorkload(name, dist.keys, float64(reads)/100, r))
+		}
+	}
+	return workloads
+}
+
+// Preload puts every other item of the workload into the tree, so that
+// about half of the reads hit.
+func (w *Workload) Preload(t Tree) {
+	for i := 0; i < len(w.Items); i += 2 {
+		t.Put(w.Items[i])
+	}
+}
+
+// Step runs the i-th operation of the workload on the tree, i wraps around
+// the length of the workload.
+func (w *Workload) Step(t Tree, i int) {
+	i %= len(w.Ops)
+	switch w.Ops[i] {
+	case OpGet:
+		t.Get(w.Items[i])
+	case OpPut:
+		t.Put(w.Items[i])
+	case OpDelete:
+		t.Delete(w.Items[i])
+	}
+}
+
+// Run runs all operations of the workload on the tree.
+func (w *Workload) Run(t Tree) {
+	for i := range w.Ops {
+		w.Step(t, i)
+	}
+}
+
+// Benchmark preloads the tree and runs b.N operations of the workload.
+func Benchmark(b *testing.B, t Tree, w *Workload) {
+	w.Preload(t)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Step(t, i)
+	}
+}
+
+// BenchmarkParallel is like Benchmark, but runs the operations from
+// parallel goroutines, the tree must be safe for concurrent use.
+func BenchmarkParallel(b *testing.B, t Tree, w *Workload) {
+	w.Preload(t)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := rand.Int()
+		for pb.Next() {
+			w.Step(t, i)
+			i++
+		}
+	})
+}
+
+// BenchmarkConcurrent is like BenchmarkParallel, but runs the operations
+// from exactly the given number of goroutines regardless of GOMAXPROCS, to
+// measure the throughput against the goroutine count.
+func BenchmarkConcurrent(b *testing.B, t Tree, w *Workload, goroutines int) {
+	w.Preload(t)
+	b.ReportAllocs()
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		// Split b.N evenly, the first goroutines take the rest.
+		n := b.N / goroutines
+		if g < b.N%goroutines {
+			n++
+		}
+		wg.Add(1)
+		go func(start, n int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				w.Step(t, start+i)
+			}
+		}(g*len(w.Ops)/goroutines, n)
+	}
+	wg.Wait()
+}
+
+// Mutex is a tree guarded by a mutex, safe for concurrent use.
+type Mutex struct {
+	mu sync.Mutex
+	t  Tree
+}
+
+// NewMutex guards the tree with a mutex.
+func NewMutex(t Tree) *Mutex { return &Mutex{t: t} }
+
+// Get gets the item under the lock.
+func (m *Mutex) Get(item htree.Item) htree.Item {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.t.Get(item)
+}
+
+// Put puts the item under the lock.
+func (m *Mutex) Put(item htree.Item) htree.Item {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.t.Put(item)
+}
+
+// Delete deletes the item under the lock.
+func (m *Mutex) Delete(item htree.Item) htree.Item {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.t.Delete(item)
+}
+
+// RWMutex is a tree guarded by a read-write mutex, safe for concurrent use
+// if reads on the tree don't write, i.e. it's not in the timestamps mode.
+type RWMutex struct {
+	mu sync.RWMutex
+	t  Tree
+}
+
+// NewRWMutex guards the tree with a read-write mutex.
+func NewRWMutex(t Tree) *RWMutex { return &RWMutex{t: t} }
+
+// Get gets the item under the read lock.
+func (m *RWMutex) Get(item htree.Item) htree.Item {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.t.Get(item)
+}
+
+// Put puts the item under the write lock.
+func (m *RWMutex) Put(item htree.Item) htree.Item {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.t.Put(item)
+}
+
+// Delete deletes the item under the write lock.
+func (m *RWMutex) Delete(item htree.Item) htree.Item {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.t.Delete(item)
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/hit9/htree"
+)
+
+func TestResidueSkewed(t *testing.T) {
+	tree := htree.New()
+	for _, key := range ResidueSkewed(1000, rand.New(rand.NewSource(1))) {
+		if key%skew != 0 {
+			t.Fatalf("key %d not skewed", key)
+		}
+		tree.Put(htree.Uint32(key))
+	}
+	if counts := tree.LevelCounts(); counts[0]+counts[1]+counts[2] != 3 {
+		t.Errorf("unexpected level counts %v", counts)
+	}
+}
+
+func TestWorkload(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	w := NewWorkload("uniform", Uniform(1000, r), 0.9, r)
+	reads := 0
+	for _, op := range w.Ops {
+		if op == OpGet {
+			reads++
+		}
+	}
+	if reads < 800 || reads > 1000 {
+		t.Errorf("unexpected reads %d", reads)
+	}
+	tree := htree.New()
+	w.Preload(tree)
+	if tree.Len() != 500 {
+		t.Errorf("unexpected preloaded length %d", tree.Len())
+	}
+	w.Run(tree)
+}
+
+func TestStandard(t *testing.T) {
+	workloads := Standard(100, 1)
+	if len(workloads) != 12 {
+		t.Fatalf("unexpected workloads %d", len(workloads))
+	}
+	for _, w := range workloads {
+		if len(w.Items) != 100 || len(w.Ops) != 100 {
+			t.Errorf("unexpected workload %s", w.Name)
+		}
+	}
+}
+
+func TestBenchmarkConcurrent(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	w := NewWorkload("uniform", Uniform(1000, r), 0.5, r)
+	for _, g := range []int{1, 3, 8} {
+		res := testing.Benchmark(func(b *testing.B) {
+			BenchmarkConcurrent(b, NewMutex(htree.New()), w, g)
+		})
+		if res.N == 0 {
+			t.Errorf("goroutines %d: no operations run", g)
+		}
+	}
+}
+
+func BenchmarkHTree(b *testing.B) {
+	for _, w := range Standard(1<<20, 1) {
+		b.Run(w.Name, func(b *testing.B) {
+			Benchmark(b, htree.New(), w)
+		})
+	}
+}
+
+// Goroutine counts of the scalability benchmarks.
+var goroutines = []int{1, 2, 4, 8, 16, 32}
+
+// BenchmarkScalability measures the throughput of the concurrent variants
+// against the number of goroutines at various read ratios, the frozen tree
+// is read-only so it only runs the 100% reads. To plot the curve:
+//
+//	go test -run - -bench Scalability -count 10 ./bench | benchstat -col /g -
+func BenchmarkScalability(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	keys := Uniform(1<<20, r)
+	variants := []struct {
+		name string
+		new  func() Tree
+	}{
+		{"mutex", func() Tree { return NewMutex(htree.New()) }},
+		{"rwmutex", func() Tree { return NewRWMutex(htree.New()) }},
+		{"rcu", func() Tree { return htree.NewRCU(htree.New()) }},
+	}
+	for _, reads := range []int{50, 90, 99, 100} {
+		w := NewWorkload(fmt.Sprintf("r%d", reads), keys, float64(reads)/100, r)
+		for _, v := range variants {
+			for _, g := range goroutines {
+				b.Run(fmt.Sprintf("%s/%s/g=%d", v.name, w.Name, g), func(b *testing.B) {
+					BenchmarkConcurrent(b, v.new(), w, g)
+				})
+			}
+		}
+	}
+	w := NewWorkload("r100", keys, 1, r)
+	frozen := htree.New()
+	w.Preload(frozen)
+	frozen.Freeze()
+	for _, g := range goroutines {
+		b.Run(fmt.Sprintf("frozen/%s/g=%d", w.Name, g), func(b *testing.B) {
+			BenchmarkConcurrent(b, readOnly{frozen}, w, g)
+		})
+	}
+}
+
+// readOnly is a tree only serving reads, the workload is preloaded already.
+type readOnly struct{ *htree.HTree }
+
+func (readOnly) Put(item htree.Item) htree.Item { return nil }
@@ -0,0 +1,154 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+// Command htree-mem measures the memory usage and build time of htree,
+// compared to map and sync.Map, and emits the results as CSV.
+//
+// Usage:
+//
+//	htree-mem -sizes 1000,1000000 -dists uniform,zipf -impls htree,map
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hit9/htree"
+)
+
+var (
+	sizes = flag.String("sizes", "1000,100000,1000000", "comma separated sizes to build")
+	dists = flag.String("dists", "uniform,sequential,zipf", "comma separated key distributions")
+	impls = flag.String("impls", "htree,compact,map,syncmap", "comma separated implementations")
+	seed  = flag.Int64("seed", 1, "random seed of the keys")
+)
+
+// builders build a container with keys, returns the number of entries and
+// the container to keep it alive.
+var builders = map[string]func(keys []uint32) (int, interface{}){
+	"htree": func(keys []uint32) (int, interface{}) {
+		t := htree.New()
+		for _, key := range keys {
+			t.Put(htree.Uint32(key))
+		}
+		return t.Len(), t
+	},
+	"compact": func(keys []uint32) (int, interface{}) {
+		t := htree.NewCompact()
+		for _, key := range keys {
+			t.Put(htree.Uint32(key))
+		}
+		return t.Len(), t
+	},
+	"map": func(keys []uint32) (int, interface{}) {
+		m := make(map[uint32]htree.Item)
+		for _, key := range keys {
+			m[key] = htree.Uint32(key)
+		}
+		return len(m), m
+	},
+	"syncmap": func(keys []uint32) (int, interface{}) {
+		m := &sync.Map{}
+		n := 0
+		for _, key := range keys {
+			if _, loaded := m.LoadOrStore(key, htree.Uint32(key)); !loaded {
+				n++
+			}
+		}
+		return n, m
+	},
+}
+
+// generate returns size keys of the distribution.
+func generate(dist string, size int, r *rand.Rand) ([]uint32, error) {
+	keys := make([]uint32, size)
+	switch dist {
+	case "uniform":
+		for i := range keys {
+			keys[i] = r.Uint32()
+		}
+	case "sequential":
+		for i := range keys {
+			keys[i] = uint32(i)
+		}
+	case "zipf":
+		z := rand.NewZipf(r, 1.1, 1, math.MaxUint32)
+		for i := range keys {
+			keys[i] = uint32(z.Uint64())
+		}
+	default:
+		return nil, fmt.Errorf("unknown distribution %q", dist)
+	}
+	return keys, nil
+}
+
+// measure builds the container and returns the number of entries, the
+// bytes allocated and the build time.
+func measure(build func([]uint32) (int, interface{}), keys []uint32) (int, uint64, time.Duration) {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	before := stats.HeapAlloc
+	start := time.Now()
+	n, c := build(keys)
+	elapsed := time.Since(start)
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	after := stats.HeapAlloc
+	runtime.KeepAlive(c)
+	if after < before {
+		return n, 0, elapsed
+	}
+	return n, after - before, elapsed
+}
+
+func main() {
+	flag.Parse()
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"impl", "dist", "size", "entries", "bytes", "bytes_per_entry", "build_ns"})
+	for _, sizeStr := range strings.Split(*sizes, ",") {
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "htree-mem: bad size %q\n", sizeStr)
+			os.Exit(2)
+		}
+		for _, dist := range strings.Split(*dists, ",") {
+			keys, err := generate(dist, size, rand.New(rand.NewSource(*seed)))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "htree-mem: %v\n", err)
+				os.Exit(2)
+			}
+			for _, impl := range strings.Split(*impls, ",") {
+				build, ok := builders[impl]
+				if !ok {
+					fmt.Fprintf(os.Stderr, "htree-mem: unknown implementation %q\n", impl)
+					os.Exit(2)
+				}
+				n, total, elapsed := measure(build, keys)
+				perEntry := 0.0
+				if n > 0 {
+					perEntry = float64(total) / float64(n)
+				}
+				w.Write([]string{
+					impl, dist, strconv.Itoa(size), strconv.Itoa(n),
+					strconv.FormatUint(total, 10),
+					strconv.FormatFloat(perEntry, 'f', 1, 64),
+					strconv.FormatInt(elapsed.Nanoseconds(), 10),
+				})
+				w.Flush()
+			}
+		}
+	}
+	if err := w.Error(); err != nil {
+		fmt.Fprintf(os.Stderr, "htree-mem: %v\n", err)
+		os.Exit(1)
+	}
+}
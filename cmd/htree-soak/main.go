@@ -0,0 +1,185 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+// Command htree-soak runs randomized operations on htrees for a long time,
+// validating the trees against map references periodically, to catch rare
+// corruptions.
+//
+// Each worker goroutine owns a tree, the workers run concurrently to stress
+// the allocator and the garbage collector. Every round a worker also takes
+// a copy-on-write clone, keeps modifying the original and checks the clone
+// stays unchanged.
+//
+// Usage:
+//
+//	htree-soak -duration 1h -workers 4 -mix get=50,put=30,delete=20 -seed 42
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hit9/htree"
+	"github.com/hit9/htree/htreetest"
+)
+
+var (
+	duration = flag.Duration("duration", time.Minute, "how long to run")
+	workers  = flag.Int("workers", runtime.NumCPU(), "number of concurrent workers")
+	mix      = flag.String("mix", "get=40,put=40,delete=20", "operation mix by weight")
+	space    = flag.Uint("keys", 1<<20, "size of the key space")
+	round    = flag.Int("round", 100000, "number of operations between validations")
+	seed     = flag.Int64("seed", time.Now().UnixNano(), "random seed")
+	maxHeap  = flag.Uint64("max-heap", 4<<30, "abort if the heap exceeds this many bytes")
+	interval = flag.Duration("report", 10*time.Second, "interval of the progress reports")
+)
+
+// parseMix parses the operation mix like "get=50,put=30,delete=20" into
+// cumulative weights indexed by kind.
+func parseMix(s string) ([]int, error) {
+	kinds := map[string]htreetest.Kind{
+		"get":    htreetest.Get,
+		"put":    htreetest.Put,
+		"delete": htreetest.Delete,
+	}
+	weights := make([]int, len(kinds))
+	for _, field := range strings.Split(s, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("bad mix %q", field)
+		}
+		kind, ok := kinds[kv[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown op %q", kv[0])
+		}
+		w, err := strconv.Atoi(kv[1])
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("bad weight %q", kv[1])
+		}
+		weights[kind] = w
+	}
+	for i := 1; i < len(weights); i++ {
+		weights[i] += weights[i-1]
+	}
+	if weights[len(weights)-1] == 0 {
+		return nil, fmt.Errorf("empty mix %q", s)
+	}
+	return weights, nil
+}
+
+// randomOp returns a random operation by the cumulative weights.
+func randomOp(r *rand.Rand, weights []int) htreetest.Op {
+	w := r.Intn(weights[len(weights)-1])
+	kind := htreetest.Kind(0)
+	for w >= weights[kind] {
+		kind++
+	}
+	return htreetest.Op{Kind: kind, Key: uint32(r.Int63n(int64(*space)))}
+}
+
+// checkFlags checks the numeric flags.
+func checkFlags() error {
+	switch {
+	case *workers < 1:
+		return fmt.Errorf("bad workers %d", *workers)
+	case *space < 1 || uint64(*space) > 1<<32:
+		return fmt.Errorf("bad keys %d, expect 1 to 2^32", *space)
+	case *round < 1:
+		return fmt.Errorf("bad round %d", *round)
+	case *interval <= 0:
+		return fmt.Errorf("bad report interval %v", *interval)
+	}
+	return nil
+}
+
+// worker runs rounds of operations until the deadline.
+func worker(id int, weights []int, deadline time.Time, ops *uint64) error {
+	r := rand.New(rand.NewSource(*seed + int64(id)))
+	c := htreetest.NewChecker(htree.New())
+	for n := 0; time.Now().Before(deadline); n++ {
+		snapshot := htreetest.NewChecker(c.Tree.CloneCOW())
+		for i := 0; i < *round; i++ {
+			op := randomOp(r, weights)
+			if err := c.Apply(op); err != nil {
+				return fmt.Errorf("worker %d round %d: %v", id, n, err)
+			}
+		}
+		atomic.AddUint64(ops, uint64(*round))
+		if err := c.Check(); err != nil {
+			return fmt.Errorf("worker %d round %d: %v", id, n, err)
+		}
+		if err := snapshot.Check(); err != nil {
+			return fmt.Errorf("worker %d round %d snapshot: %v", id, n, err)
+		}
+	}
+	return nil
+}
+
+func main() {
+	flag.Parse()
+	log.SetPrefix("htree-soak: ")
+	if err := checkFlags(); err != nil {
+		fmt.Fprintf(os.Stderr, "htree-soak: %v\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	weights, err := parseMix(*mix)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("seed %d, %d workers, %v", *seed, *workers, *duration)
+	var (
+		ops      uint64
+		wg       sync.WaitGroup
+		errs     = make(chan error, *workers)
+		deadline = time.Now().Add(*duration)
+	)
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			if err := worker(id, weights, deadline, &ops); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	var stats runtime.MemStats
+	for {
+		select {
+		case err := <-errs:
+			log.Printf("FAIL seed %d: %v", *seed, err)
+			os.Exit(1)
+		case <-ticker.C:
+			runtime.ReadMemStats(&stats)
+			log.Printf("%d ops, heap %d MB, %d GCs", atomic.LoadUint64(&ops), stats.HeapAlloc>>20, stats.NumGC)
+			if stats.HeapAlloc > *maxHeap {
+				log.Printf("FAIL seed %d: heap %d exceeds %d", *seed, stats.HeapAlloc, *maxHeap)
+				os.Exit(1)
+			}
+		case <-done:
+			select {
+			case err := <-errs:
+				log.Printf("FAIL seed %d: %v", *seed, err)
+				os.Exit(1)
+			default:
+			}
+			log.Printf("PASS %d ops", atomic.LoadUint64(&ops))
+			return
+		}
+	}
+}
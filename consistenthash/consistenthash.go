@@ -0,0 +1,221 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+// Package consistenthash implements a consistent hash ring on htree, the
+// virtual node points are keys in an ordered htree, and a hash is located
+// to the node of its successor point. A point takes 8 bytes plus the htree
+// overhead.
+//
+// Example:
+//
+//	ring := consistenthash.New(100)
+//	ring.AddNode("cache-1")
+//	ring.AddNode("cache-2")
+//	node := ring.LocateKey("user:42")
+package consistenthash // import "github.com/hit9/htree/consistenthash"
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"github.com/hit9/htree"
+)
+
+// point is a virtual node on the ring.
+type point struct {
+	key  uint32
+	node int32 // index of the node name
+}
+
+// Key returns the position of the point.
+func (p point) Key() uint32 { return p.key }
+
+// Ring is a consistent hash ring, it's not safe for concurrent use.
+type Ring struct {
+	tree     *htree.HTree
+	spill    []point // points the tree can't place, sorted by key
+	replicas int
+	hash     func([]byte) uint32
+	names    []string         // node names by index, "" if freed
+	free     []int32          // freed indexes of names
+	nodes    map[string]int32 // node name to index
+	collided bool             // any nodes ever placed on the same point
+}
+
+// Option configures a ring on creation.
+type Option func(r *Ring)
+
+// WithHash sets the hash function of the virtual node labels and the keys
+// located by LocateKey, defaults to 32-bit FNV-1a with a final mix.
+func WithHash(hash func([]byte) uint32) Option {
+	return func(r *Ring) { r.hash = hash }
+}
+
+// mixedFNV is the default hash function, the FNV-1a hash finalized by the
+// murmur3 mixer, since FNV spreads similar short labels poorly.
+func mixedFNV(b []byte) uint32 {
+	h := fnv.New32a()
+	h.Write(b)
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
+
+// New creates a ring placing the given number of virtual nodes per node.
+func New(replicas int, opts ...Option) *Ring {
+	r := &Ring{
+		tree:     htree.New(htree.WithOrderedIndex()),
+		replicas: replicas,
+		hash:     mixedFNV,
+		nodes:    map[string]int32{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// points calls f with the positions of the virtual nodes of the node.
+func (r *Ring) points(name string, f func(key uint32)) {
+	label := append([]byte(name), '#')
+	for i := 0; i < r.replicas; i++ {
+		f(r.hash(strconv.AppendInt(label, int64(i), 10)))
+	}
+}
+
+// spilled returns the position of the first point in the spill at or
+// after the key, and whether it's at the key.
+func (r *Ring) spilled(key uint32) (int, bool) {
+	i := sort.Search(len(r.spill), func(i int) bool { return r.spill[i].key >= key })
+	return i, i < len(r.spill) && r.spill[i].key == key
+}
+
+// get returns the point at the key.
+func (r *Ring) get(key uint32) (point, bool) {
+	if p := r.tree.GetKey(key); p != nil {
+		return p.(point), true
+	}
+	if i, ok := r.spilled(key); ok {
+		return r.spill[i], true
+	}
+	return point{}, false
+}
+
+// place puts a point of the node, on collision the node with the smaller
+// name takes the point, so the ring doesn't depend on the order of the
+// node additions. The points the tree can't place are spilled.
+func (r *Ring) place(key uint32, node int32) {
+	p := point{key, node}
+	if old, ok := r.get(key); ok {
+		r.collided = true
+		if r.names[old.node] <= r.names[node] {
+			return
+		}
+		if r.tree.Replace(p) == nil {
+			i, _ := r.spilled(key)
+			r.spill[i] = p
+		}
+		return
+	}
+	if r.tree.Put(p) == nil {
+		i, _ := r.spilled(key)
+		r.spill = append(r.spill, point{})
+		copy(r.spill[i+1:], r.spill[i:])
+		r.spill[i] = p
+	}
+}
+
+// AddNode adds the node with its virtual nodes, it's a no-op if the node is
+// already in the ring.
+func (r *Ring) AddNode(name string) {
+	if _, ok := r.nodes[name]; ok {
+		return
+	}
+	var node int32
+	if n := len(r.free); n > 0 {
+		node, r.free = r.free[n-1], r.free[:n-1]
+		r.names[node] = name
+	} else {
+		node = int32(len(r.names))
+		r.names = append(r.names, name)
+	}
+	r.nodes[name] = node
+	r.points(name, func(key uint32) { r.place(key, node) })
+}
+
+// RemoveNode removes the node with its virtual nodes, it's a no-op if the
+// node is not in the ring.
+func (r *Ring) RemoveNode(name string) {
+	node, ok := r.nodes[name]
+	if !ok {
+		return
+	}
+	r.points(name, func(key uint32) {
+		if p := r.tree.GetKey(key); p != nil {
+			if p.(point).node == node {
+				r.tree.Delete(p)
+			}
+		} else if i, ok := r.spilled(key); ok && r.spill[i].node == node {
+			r.spill = append(r.spill[:i], r.spill[i+1:]...)
+		}
+	})
+	delete(r.nodes, name)
+	r.names[node] = ""
+	r.free = append(r.free, node)
+	if r.collided {
+		// The points this node took on collisions are released, let the
+		// other nodes take them back.
+		for other, i := range r.nodes {
+			r.points(other, func(key uint32) { r.place(key, i) })
+		}
+	}
+}
+
+// Locate returns the node of the first point at or after the hash, wraps
+// around to the first point on the ring. It returns "" if the ring is
+// empty.
+func (r *Ring) Locate(hash uint32) string {
+	p, ok := r.ceil(hash)
+	if !ok {
+		if p, ok = r.ceil(0); !ok {
+			return ""
+		}
+	}
+	return r.names[p.node]
+}
+
+// ceil returns the first point at or after the hash, in the tree or the
+// spill.
+func (r *Ring) ceil(hash uint32) (point, bool) {
+	var p point
+	item := r.tree.Ceil(hash)
+	if item != nil {
+		p = item.(point)
+	}
+	if i, _ := r.spilled(hash); i < len(r.spill) && (item == nil || r.spill[i].key < p.key) {
+		return r.spill[i], true
+	}
+	return p, item != nil
+}
+
+// LocateKey locates the hash of the key.
+func (r *Ring) LocateKey(key string) string {
+	return r.Locate(r.hash([]byte(key)))
+}
+
+// Nodes returns the names of the nodes in the ring, sorted.
+func (r *Ring) Nodes() []string {
+	names := make([]string, 0, len(r.nodes))
+	for name := range r.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Points returns the number of virtual nodes on the ring.
+func (r *Ring) Points() int { return r.tree.Len() + len(r.spill) }
@@ -0,0 +1,116 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package consistenthash
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	r := New(100)
+	if r.LocateKey("a") != "" {
+		t.Fatal("empty ring located a node")
+	}
+	for i := 0; i < 5; i++ {
+		r.AddNode("node-" + strconv.Itoa(i))
+	}
+	if r.Points() != 500 {
+		t.Fatalf("unexpected points %d", r.Points())
+	}
+	counts := map[string]int{}
+	owners := map[string]string{}
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = r.LocateKey(key)
+		counts[owners[key]]++
+	}
+	for name, n := range counts {
+		if n < 1000 || n > 3000 {
+			t.Errorf("unbalanced node %s: %d keys", name, n)
+		}
+	}
+	// Removing a node moves only its keys.
+	r.RemoveNode("node-2")
+	if r.Points() != 400 || len(r.Nodes()) != 4 {
+		t.Fatalf("unexpected ring %d %v", r.Points(), r.Nodes())
+	}
+	for key, owner := range owners {
+		node := r.LocateKey(key)
+		if node == "node-2" || (owner != "node-2" && node != owner) {
+			t.Fatalf("key %s moved from %s to %s", key, owner, node)
+		}
+	}
+	// Adding it back restores the ring.
+	r.AddNode("node-2")
+	for key, owner := range owners {
+		if node := r.LocateKey(key); node != owner {
+			t.Fatalf("key %s moved from %s to %s", key, owner, node)
+		}
+	}
+}
+
+func TestRingWraps(t *testing.T) {
+	r := New(1, WithHash(func(b []byte) uint32 { return 100 }))
+	r.AddNode("a")
+	if r.Locate(100) != "a" || r.Locate(101) != "a" || r.Locate(0) != "a" {
+		t.Error("not wrapped")
+	}
+}
+
+func TestRingCollisions(t *testing.T) {
+	// All nodes on the same point, the smallest name takes it.
+	hash := func(b []byte) uint32 { return 7 }
+	a, b := New(3, WithHash(hash)), New(3, WithHash(hash))
+	a.AddNode("x")
+	a.AddNode("y")
+	b.AddNode("y")
+	b.AddNode("x")
+	if a.Locate(0) != "x" || b.Locate(0) != "x" {
+		t.Fatal("ring depends on the addition order")
+	}
+	a.RemoveNode("x")
+	if a.Locate(0) != "y" || a.Points() != 1 {
+		t.Fatal("collided point not released")
+	}
+	a.RemoveNode("y")
+	a.RemoveNode("y")
+	if a.Locate(0) != "" || a.Points() != 0 {
+		t.Fatal("ring not empty")
+	}
+}
+
+func TestRingOverflow(t *testing.T) {
+	// Points sharing the residues of all primes overflow the tree at 10.
+	step := uint32(2 * 3 * 5 * 7 * 11 * 13 * 17 * 19 * 23)
+	keys := map[string]uint32{"a": 5 + 11*step}
+	for i := uint32(0); i < 12; i++ {
+		keys["n"+strconv.Itoa(int(10+i))] = 5 + i*step
+	}
+	r := New(1, WithHash(func(b []byte) uint32 { return keys[string(b[:len(b)-2])] }))
+	for i := 0; i < 12; i++ {
+		r.AddNode("n" + strconv.Itoa(10+i))
+	}
+	if r.Points() != 12 {
+		t.Fatalf("unexpected points %d", r.Points())
+	}
+	for i := uint32(0); i < 12; i++ {
+		if node := r.Locate(4 + i*step); node != "n"+strconv.Itoa(int(10+i)) {
+			t.Fatalf("point %d located to %s", i, node)
+		}
+	}
+	// Takes a spilled point.
+	r.AddNode("a")
+	if r.Points() != 12 || r.Locate(5+11*step) != "a" {
+		t.Fatal("spilled point not taken")
+	}
+	r.RemoveNode("a")
+	r.RemoveNode("n15")
+	if r.Points() != 11 || r.Locate(5+11*step) != "n21" || r.Locate(5+5*step) != "n16" {
+		t.Fatal("unexpected ring")
+	}
+	r.RemoveNode("n21")
+	if r.Points() != 10 || r.Locate(5+11*step) != "n10" {
+		t.Fatal("spilled point not removed")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+// Package counter implements per-key int64 counters on htree, for counting
+// metrics of high cardinality, e.g. requests by user id, where the memory
+// overhead of a map is the problem. The counters are sharded by key, each
+// shard is a htree guarded by its own mutex, so the increments of different
+// keys rarely contend.
+//
+// Example:
+//
+//	c := counter.New(64)
+//	c.Incr(userID, 1)
+//	for _, count := range c.SnapshotAndReset() {
+//		report(count.Key, count.Value)
+//	}
+package counter // import "github.com/hit9/htree/counter"
+
+import (
+	"sync"
+
+	"github.com/hit9/htree"
+)
+
+// Count is the value of a counter.
+type Count struct {
+	Key   uint32
+	Value int64
+}
+
+// entry is a counter in a shard.
+type entry struct {
+	key   uint32
+	value int64
+}
+
+// Key returns the counter key.
+func (e *entry) Key() uint32 { return e.key }
+
+// shard is a part of the counters guarded by a mutex.
+type shard struct {
+	mu       sync.Mutex
+	counters *htree.Overflow
+}
+
+// Counters is a set of counters by uint32 keys, safe for concurrent use.
+type Counters struct {
+	shards []shard
+	shift  uint // 32 - log2(len(shards))
+}
+
+// New creates counters of the given number of shards, rounded up to a power
+// of 2.
+func New(shards int) *Counters {
+	n, shift := 1, uint(32)
+	for n < shards {
+		n <<= 1
+		shift--
+	}
+	c := &Counters{shards: make([]shard, n), shift: shift}
+	for i := range c.shards {
+		c.shards[i].counters = htree.NewOverflow()
+	}
+	return c
+}
+
+// shard returns the shard of the key, by fibonacci hashing, so that the
+// keys of a shard are not biased on the residues.
+func (c *Counters) shard(key uint32) *shard {
+	if c.shift == 32 {
+		return &c.shards[0]
+	}
+	return &c.shards[key*2654435769>>c.shift]
+}
+
+// Incr adds delta to the counter of the key and returns the new value.
+func (c *Counters) Incr(key uint32, delta int64) int64 {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item := s.counters.Get(key)
+	if item == nil {
+		item = s.counters.Put(&entry{key: key})
+	}
+	e := item.(*entry)
+	e.value += delta
+	return e.value
+}
+
+// Get returns the value of the counter of the key, 0 if it's absent.
+func (c *Counters) Get(key uint32) int64 {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.counters.Get(key); e != nil {
+		return e.(*entry).value
+	}
+	return 0
+}
+
+// Len returns the number of counters.
+func (c *Counters) Len() int {
+	n := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		n += s.counters.Len()
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// SnapshotAndReset returns the counters in no particular order and removes
+// them. Each shard is swapped atomically, so no increment is lost or
+// counted twice, but the increments racing with the call may land in this
+// snapshot or the next one.
+func (c *Counters) SnapshotAndReset() []Count {
+	var counts []Count
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		counters := s.counters
+		s.counters = htree.NewOverflow()
+		s.mu.Unlock()
+		counters.Walk(func(item htree.Item) bool {
+			e := item.(*entry)
+			counts = append(counts, Count{e.key, e.value})
+			return true
+		})
+	}
+	return counts
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package counter
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCounters(t *testing.T) {
+	c := New(4)
+	if n := c.Incr(1, 2); n != 2 {
+		t.Fatalf("unexpected value %d", n)
+	}
+	if n := c.Incr(1, -3); n != -1 {
+		t.Fatalf("unexpected value %d", n)
+	}
+	c.Incr(2, 5)
+	if c.Get(1) != -1 || c.Get(2) != 5 || c.Get(3) != 0 {
+		t.Fatal("unexpected values")
+	}
+	if c.Len() != 2 {
+		t.Fatalf("unexpected length %d", c.Len())
+	}
+	counts := c.SnapshotAndReset()
+	if len(counts) != 2 {
+		t.Fatalf("unexpected snapshot %v", counts)
+	}
+	for _, count := range counts {
+		if (count.Key == 1 && count.Value != -1) || (count.Key == 2 && count.Value != 5) {
+			t.Errorf("unexpected count %v", count)
+		}
+	}
+	if c.Len() != 0 || c.Get(1) != 0 {
+		t.Fatal("counters not reset")
+	}
+}
+
+func TestCountersOverflow(t *testing.T) {
+	c := New(1)
+	// Keys sharing all the remainders of the first 9 primes.
+	step := uint32(2 * 3 * 5 * 7 * 11 * 13 * 17 * 19 * 23)
+	for i := uint32(0); i < 12; i++ {
+		c.Incr(i*step, int64(i))
+	}
+	if c.Len() != 12 || c.Get(11*step) != 11 {
+		t.Fatalf("unexpected length %d", c.Len())
+	}
+	if counts := c.SnapshotAndReset(); len(counts) != 12 {
+		t.Fatalf("unexpected snapshot length %d", len(counts))
+	}
+}
+
+func TestCountersConcurrent(t *testing.T) {
+	c := New(8)
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total int64
+	)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				c.Incr(uint32(i%100), 1)
+				if i%300 == 0 {
+					n := int64(0)
+					for _, count := range c.SnapshotAndReset() {
+						n += count.Value
+					}
+					mu.Lock()
+					total += n
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, count := range c.SnapshotAndReset() {
+		total += count.Value
+	}
+	if total != 8000 {
+		t.Errorf("unexpected total %d", total)
+	}
+}
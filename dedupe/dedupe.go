@@ -0,0 +1,66 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+// Package dedupe implements a bounded de-duplication filter on htree, for
+// streaming pipelines asking "is this ID processed recently?". It holds at
+// most a fixed number of the latest keys, the oldest keys are evicted first,
+// so the memory is bounded while the answers are exact within the window.
+//
+// Example:
+//
+//	f := dedupe.New(1 << 20)
+//	for id := range ids {
+//		if !f.Seen(id) {
+//			process(id)
+//		}
+//	}
+package dedupe // import "github.com/hit9/htree/dedupe"
+
+import "github.com/hit9/htree"
+
+// Filter is a bounded de-duplication filter, it's not safe for concurrent
+// use.
+type Filter struct {
+	keys *htree.Overflow
+	ring []uint32 // keys in insertion order, a ring buffer
+	head int      // position of the oldest key in ring
+	n    int      // number of keys in ring
+}
+
+// New creates a filter remembering up to capacity keys.
+func New(capacity int) *Filter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Filter{keys: htree.NewOverflow(), ring: make([]uint32, capacity)}
+}
+
+// Seen reports whether the key is in the filter, and remembers it if not.
+// The oldest key is evicted if the filter is full. Seeing a remembered key
+// again doesn't refresh it.
+func (f *Filter) Seen(key uint32) bool {
+	if f.keys.Get(key) != nil {
+		return true
+	}
+	f.keys.Put(htree.Uint32(key))
+	if f.n == len(f.ring) {
+		f.keys.Delete(f.ring[f.head])
+		f.ring[f.head] = key
+		f.head = (f.head + 1) % len(f.ring)
+		return false
+	}
+	f.ring[(f.head+f.n)%len(f.ring)] = key
+	f.n++
+	return false
+}
+
+// Len returns the number of keys remembered.
+func (f *Filter) Len() int { return f.n }
+
+// Cap returns the max number of keys remembered.
+func (f *Filter) Cap() int { return len(f.ring) }
+
+// Reset forgets all keys.
+func (f *Filter) Reset() {
+	f.keys = htree.NewOverflow()
+	f.head, f.n = 0, 0
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package dedupe
+
+import "testing"
+
+func TestFilter(t *testing.T) {
+	f := New(3)
+	for _, key := range []uint32{1, 2, 3} {
+		if f.Seen(key) {
+			t.Fatalf("key %d seen", key)
+		}
+	}
+	if !f.Seen(1) || !f.Seen(3) || f.Len() != 3 {
+		t.Fatal("keys not remembered")
+	}
+	// Evicts the oldest.
+	if f.Seen(4) {
+		t.Fatal("key 4 seen")
+	}
+	if f.Len() != 3 || f.Cap() != 3 {
+		t.Fatalf("unexpected length %d", f.Len())
+	}
+	if f.Seen(1) {
+		t.Fatal("key 1 not evicted")
+	}
+	// Key 1 evicted 2.
+	if f.Seen(2) {
+		t.Fatal("key 2 not evicted")
+	}
+	if !f.Seen(4) || !f.Seen(1) {
+		t.Fatal("recent keys not remembered")
+	}
+	f.Reset()
+	if f.Len() != 0 || f.Seen(4) {
+		t.Fatal("not reset")
+	}
+}
+
+func TestFilterWindow(t *testing.T) {
+	f := New(1000)
+	for key := uint32(0); key < 100000; key++ {
+		if f.Seen(key) {
+			t.Fatalf("key %d seen", key)
+		}
+		if key >= 1000 && !f.Seen(key-999) {
+			t.Fatalf("key %d forgotten", key-999)
+		}
+	}
+	if f.keys.Len() != 1000 {
+		t.Fatalf("unexpected keys length %d", f.keys.Len())
+	}
+}
+
+func TestFilterCollidingKeys(t *testing.T) {
+	f := New(15)
+	// Keys sharing the residues of all primes overflow the tree at 10.
+	step := uint32(2 * 3 * 5 * 7 * 11 * 13 * 17 * 19 * 23)
+	for i := uint32(0); i < 20; i++ {
+		if f.Seen(5 + i*step) {
+			t.Fatalf("key %d seen", i)
+		}
+		if !f.Seen(5 + i*step) {
+			t.Fatalf("key %d not remembered", i)
+		}
+	}
+	// The latest 15 are remembered.
+	for i := uint32(5); i < 20; i++ {
+		if !f.Seen(5 + i*step) {
+			t.Fatalf("key %d forgotten", i)
+		}
+	}
+	if f.Seen(5) || f.Len() != 15 || f.keys.Len() != 15 {
+		t.Fatalf("unexpected length %d", f.keys.Len())
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/hit9/htree
 
-go 1.15
+go 1.19
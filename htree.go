@@ -61,9 +61,22 @@ Goroutine Safety
 
 No. Lock granularity depends on the use case.
 
+A frozen tree is read-only and safe for concurrent reads without locks, see
+HTree.Freeze. A Holder swaps frozen trees atomically for read-mostly tables.
+RCU wraps a tree for lock-free reads with serialized copy-on-write writes.
+Map is a sync.Map compatible adapter keyed by uint32, with RCU style reads.
+
 */
 package htree // import "github.com/hit9/htree"
 
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
 // Item is a single object in the tree.
 type Item interface {
 	// Key returns an uint32 number to distinguish node with another.
@@ -78,30 +91,109 @@ func (i Uint32) Key() uint32 {
 	return uint32(i)
 }
 
+// Int32 implements the Item interface for signed keys.
+type Int32 int32
+
+// Key returns the htree node key, the value biased by 2^31, which keeps the
+// order of the values, i.e. math.MinInt32 is 0 and 0 is 2^31.
+func (i Int32) Key() uint32 {
+	return uint32(i) ^ 1<<31
+}
+
 type children []*node
 
-// node is an internel node in the htree.
+// stamped wraps an item with its timestamps in the timestamps mode.
+type stamped struct {
+	Item
+	inserted int64 // unix nanoseconds
+	accessed int64 // unix nanoseconds
+}
+
+// Size of a pointer in bytes, 8 on 64-bit platforms, 4 on 32-bit ones.
+const ptrSize = 4 << (^uintptr(0) >> 63)
+
+// node is an internel node in the htree. The depth of a node is not
+// stored but tracked on the way down from the root.
 type node struct {
 	item      Item
-	depth     int8     // int8 number on [0,10]
-	remainder int8     // item.Key()%primes[father.depth]
-	children  children // ordered by remainder
+	spill     **node                // first of the children once outgrow inline
+	inline    [inlineChildren]*node // children if not spilled
+	owner     uint32                // id of the tree owning this node
+	remainder int8                  // item.Key()%primes[father's depth]
+	size      int8                  // number of children
 }
 
 // HTree is the hash-tree.
 type HTree struct {
-	root      *node // empty root node
-	length    int   // number of nodes
-	conflicts int   // number of conflicts
+	root        *node             // empty root node
+	length      int               // number of nodes
+	duplicates  int               // number of puts on existing keys
+	inserts     [10]int           // number of new inserts by depth
+	levels      [10]int           // number of items by depth
+	height      int               // max depth occupied
+	generation  uint64            // number of modifications
+	timestamps  bool              // record insert and access time of items
+	clock       Clock             // time source of the timestamps
+	frozen      bool              // read-only
+	owner       uint32            // id to own nodes, the others are shared with clones
+	instrument  Instrument        // observer of operations, optional
+	index       *keyIndex         // sorted keys, optional
+	changes     *changeLog        // generations of the changes, optional
+	appender    *Appender         // change log writer, optional
+	secondaries *secondaryIndexes // secondary indexes, optional
+	probes      *probes           // probe depth histograms, optional
+}
+
+// Last allocated tree owner id.
+var owners uint32
+
+// ErrFrozen is the panic value of modifications on a frozen htree.
+var ErrFrozen = errors.New("htree: modify frozen tree")
+
+// ErrDepthOverflow is returned by the operations which can't leave out an
+// item overflowing the depth of the htree silently, see HTree.Put.
+var ErrDepthOverflow = errors.New("htree: depth overflows")
+
+// Clock is the time source used by the time dependent features, e.g. the
+// timestamps mode.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
 }
 
-// Iterator is an iterator on the htree.
+// systemClock is the default clock, reads the system time.
+type systemClock struct{}
+
+// Now returns the current system time.
+func (systemClock) Now() time.Time { return time.Now() }
+
+// Option configures a htree on creation.
+type Option func(t *HTree)
+
+// WithClock sets the time source of the htree, defaults to the system clock.
+func WithClock(c Clock) Option {
+	return func(t *HTree) { t.clock = c }
+}
+
+// WithTimestamps records the insert time and the last access time of each
+// item, they are queryable via the iterator. This costs an extra allocation
+// of 32 bytes per item.
+func WithTimestamps() Option {
+	return func(t *HTree) { t.timestamps = true }
+}
+
+// Iterator is an iterator on the htree. The stacks are bounded by the
+// number of primes, so iterators don't allocate.
 type Iterator struct {
 	t       *HTree
-	fathers []*node // stack of father node
-	indexes []int   // stack of father's index in the brothers
-	n       *node   // current node
-	i       int     // current index in n's brothers
+	fathers [len(primes) + 1]*node // stack of father node
+	indexes [len(primes) + 1]int   // stack of father's index in the brothers
+	depth   int                    // stack size, the depth of n
+	n       *node                  // current node
+	i       int                    // current index in n's brothers
+	visited int                    // position of the current item, from 1
+	total   int                    // tree length on creation
+	end     bool                   // past the last item
 }
 
 // Prime numbers to build the tree.
@@ -112,37 +204,123 @@ func modulo(key uint32, depth int8) int8 {
 	return int8(key % uint32(primes[depth]))
 }
 
+// KeyPath is a key with its precomputed remainders against all the primes,
+// i.e. the path of the key in the htree. Callers operating on the same keys
+// repeatedly can keep the paths to skip the modulo work.
+type KeyPath struct {
+	key uint32
+	rs  [10]int8 // rs[d] = key % primes[d]
+}
+
+// NewKeyPath computes all remainders of the key once. The divisors are
+// constants, which are compiled into multiplications instead of divisions.
+func NewKeyPath(key uint32) KeyPath {
+	return KeyPath{key, [10]int8{
+		int8(key % 2), int8(key % 3), int8(key % 5), int8(key % 7),
+		int8(key % 11), int8(key % 13), int8(key % 17), int8(key % 19),
+		int8(key % 23), int8(key % 29),
+	}}
+}
+
+// Key returns the key of the path.
+func (p KeyPath) Key() uint32 { return p.key }
+
 // newNode creates a new node.
-func newNode(item Item, depth int8, remainder int8) *node {
-	// item,depth,remainder won't be rewritten once init.
+func newNode(item Item, remainder int8, owner uint32) *node {
+	// item,remainder won't be rewritten once init.
 	return &node{
 		item:      item,
-		depth:     depth,
 		remainder: remainder,
+		owner:     owner,
 	}
 }
 
-// insert a node into the children slice at index i.
-func (s *children) insert(i int, n *node) {
-	*s = append(*s, nil)
-	if i < len(*s) {
-		copy((*s)[i+1:], (*s)[i:])
+// value returns the item of the node, unwrapped from the timestamps.
+func (n *node) value() Item {
+	if s, ok := n.item.(*stamped); ok {
+		return s.Item
 	}
-	(*s)[i] = n
+	return n.item
 }
 
-// delete a node from the children slice at index i.
-func (s *children) delete(i int) {
-	(*s) = append((*s)[:i], (*s)[i+1:]...)
+// children returns the children of the node ordered by remainder.
+func (n *node) children() children {
+	if n.spill != nil {
+		return unsafe.Slice(n.spill, n.size)
+	}
+	return n.inline[:n.size]
+}
+
+// spillCap returns the capacity of the spilled array for size children,
+// the power of two not less than size.
+func spillCap(size int) int {
+	c := 2 * inlineChildren
+	for c < size {
+		c <<= 1
+	}
+	return c
+}
+
+// spillTo moves the children s to a new heap array of given capacity.
+func (n *node) spillTo(s children, capacity int) {
+	c := make(children, capacity)
+	copy(c, s)
+	n.inline = [inlineChildren]*node{}
+	n.spill = &c[0]
+}
+
+// adopt sets the children of the node to a copy of s, stored inline if
+// fits.
+func (n *node) adopt(s children) {
+	n.size = int8(len(s))
+	if len(s) <= len(n.inline) {
+		n.spill = nil
+		n.inline = [inlineChildren]*node{}
+		copy(n.inline[:], s)
+		return
+	}
+	n.spillTo(s, spillCap(len(s)))
+}
+
+// insertChild inserts a child at index i, spills the children to the heap
+// if inline is full.
+func (n *node) insertChild(i int, child *node) {
+	size := int(n.size)
+	var s children
+	switch {
+	case n.spill == nil && size < len(n.inline):
+		s = n.inline[:size+1]
+	case n.spill == nil || size == spillCap(size):
+		// Full, grow.
+		n.spillTo(n.children(), spillCap(size+1))
+		fallthrough
+	default:
+		s = unsafe.Slice(n.spill, size+1)
+	}
+	copy(s[i+1:], s[i:size])
+	s[i] = child
+	n.size++
+}
+
+// deleteChild deletes the child at index i, moves the children back to
+// inline once fit.
+func (n *node) deleteChild(i int) {
+	s := n.children()
+	copy(s[i:], s[i+1:])
+	s[len(s)-1] = nil
+	n.size--
+	if n.spill != nil && int(n.size) <= len(n.inline) {
+		n.adopt(s[:n.size])
+	}
 }
 
 // search child by remainder via binary-search, returns the result
 // and left/right positions.
-func (s *children) search(r int8) (ok bool, left, right int) {
-	right = len(*s) - 1
+func (s children) search(r int8) (ok bool, left, right int) {
+	right = len(s) - 1
 	for left < right {
 		mid := (left + right) >> 1
-		child := (*s)[mid]
+		child := s[mid]
 		if r > child.remainder {
 			left = mid + 1
 		} else {
@@ -150,7 +328,7 @@ func (s *children) search(r int8) (ok bool, left, right int) {
 		}
 	}
 	if left == right {
-		child := (*s)[left]
+		child := s[left]
 		if r == child.remainder {
 			ok = true
 			return
@@ -160,29 +338,125 @@ func (s *children) search(r int8) (ok bool, left, right int) {
 }
 
 // New creates a new htree.
-func New() *HTree {
-	return &HTree{root: &node{}}
+func New(opts ...Option) *HTree {
+	t := &HTree{root: &node{}, clock: systemClock{}}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
 }
 
 // Len returns the number of nodes in the tree.
 func (t *HTree) Len() int { return t.length }
 
 // Conflicts returns the number of conflicts in the tree.
-func (t *HTree) Conflicts() int { return t.conflicts }
+//
+// Deprecated: Conflicts only counts the puts on existing keys, use Duplicates
+// instead, and InsertDepths or DeepInserts for the hash path congestion.
+func (t *HTree) Conflicts() int { return t.duplicates }
+
+// Duplicates returns the number of puts on keys already in the tree.
+func (t *HTree) Duplicates() int { return t.duplicates }
+
+// InsertDepths returns the depth distribution of new inserts, the i-th
+// element is the number of inserts landed at depth i+1.
+func (t *HTree) InsertDepths() []int {
+	depths := make([]int, len(t.inserts))
+	copy(depths, t.inserts[:])
+	return depths
+}
+
+// DeepInserts returns the number of new inserts landed at depth k or deeper.
+func (t *HTree) DeepInserts(k int) int {
+	if k < 1 {
+		k = 1
+	}
+	sum := 0
+	for d := k; d <= len(t.inserts); d++ {
+		sum += t.inserts[d-1]
+	}
+	return sum
+}
+
+// LevelCounts returns the number of items at each depth, the i-th element
+// is the number of items at depth i+1.
+func (t *HTree) LevelCounts() []int {
+	counts := make([]int, len(t.levels))
+	copy(counts, t.levels[:])
+	return counts
+}
+
+// Height returns the max depth occupied by items, 0 for an empty tree.
+func (t *HTree) Height() int { return t.height }
+
+// leave decrements the number of items at given depth and lowers the
+// height if the deepest level becomes empty.
+func (t *HTree) leave(depth int8) {
+	t.levels[depth-1]--
+	for t.height > 0 && t.levels[t.height-1] == 0 {
+		t.height--
+	}
+}
+
+// Generation returns the modification generation of the htree, it's
+// incremented on every new insert and delete, but not on puts of existing
+// keys. Callers can compare generations to detect changes cheaply.
+func (t *HTree) Generation() uint64 { return t.generation }
+
+// Freeze makes the htree read-only, further Put and Delete panic with
+// ErrFrozen. A frozen tree is safe to share across goroutines without locks,
+// reads on it don't update the access timestamps.
+func (t *HTree) Freeze() { t.frozen = true }
 
-// get item recursively, nil on not found.
-func (t *HTree) get(n *node, item Item) Item {
-	r := modulo(item.Key(), n.depth)
-	ok, left, _ := n.children.search(r)
+// Frozen reports whether the htree is frozen.
+func (t *HTree) Frozen() bool { return t.frozen }
+
+// ResetConflicts zeros the number of duplicate puts.
+func (t *HTree) ResetConflicts() { t.duplicates = 0 }
+
+// ResetStats zeros all the statistic counters of the tree, the items are
+// kept untouched.
+func (t *HTree) ResetStats() {
+	t.duplicates = 0
+	t.inserts = [10]int{}
+	if t.probes != nil {
+		t.probes.reset()
+	}
+}
+
+// touch updates the access time of the node in the timestamps mode.
+func (t *HTree) touch(n *node) {
+	if s, ok := n.item.(*stamped); ok {
+		s.accessed = t.clock.Now().UnixNano()
+	}
+}
+
+// mutable returns the node if it's owned by the tree, else a copy of it
+// owned by the tree, which shares the grandchildren with the node.
+func (t *HTree) mutable(n *node) *node {
+	if n.owner == t.owner {
+		return n
+	}
+	c := *n
+	c.owner = t.owner
+	c.adopt(n.children())
+	return &c
+}
+
+// get node recursively, nil on not found. The depth is of node n.
+func (t *HTree) get(n *node, depth int8, p *KeyPath) *node {
+	r := p.rs[depth]
+	children := n.children()
+	ok, left, _ := children.search(r)
 	if ok {
 		// Get the child with the same remainder.
-		child := n.children[left]
-		if child.item.Key() == item.Key() {
+		child := children[left]
+		if child.item.Key() == p.key {
 			// Found.
-			return child.item
+			return child
 		}
 		// Next depth.
-		return t.get(child, item)
+		return t.get(child, depth+1, p)
 	}
 	// Not found.
 	return nil
@@ -190,91 +464,467 @@ func (t *HTree) get(n *node, item Item) Item {
 
 // put finds item recursively, if the node with given item is
 // found, returns it. Otherwise new a node with the item.If the
-// depth overflows, nil is returned.
-func (t *HTree) put(n *node, item Item) Item {
-	r := modulo(item.Key(), n.depth)
-	ok, left, right := n.children.search(r)
+// depth overflows, nil is returned. The node n is returned as
+// well, or its copy if it's modified but not owned by the tree.
+func (t *HTree) put(n *node, depth int8, p *KeyPath, item Item) (Item, *node) {
+	r := p.rs[depth]
+	children := n.children()
+	ok, left, right := children.search(r)
 	if ok {
 		// Get the child with the same remainder.
-		child := n.children[left]
-		if child.item.Key() == item.Key() {
-			t.conflicts++
-			return child.item // reuse
+		child := children[left]
+		if child.item.Key() == p.key {
+			t.duplicates++
+			t.touch(child)
+			return child.value(), n // reuse
 		}
 		// Next depth.
-		return t.put(child, item)
+		result, c := t.put(child, depth+1, p, item)
+		if c != child {
+			n = t.mutable(n)
+			n.children()[left] = c
+		}
+		return result, n
 	}
-	if n.depth >= int8(len(primes)-1) {
-		return nil // depth overflows
+	if depth >= int8(len(primes)-1) {
+		return nil, n // depth overflows
 	}
 	// Create a new node.
-	child := newNode(item, n.depth+1, r)
-	if len(n.children) == 0 || (right == len(n.children)-1 &&
-		r >= n.children[right].remainder) {
-		n.children = append(n.children, child)
+	stored := item
+	if t.timestamps {
+		now := t.clock.Now().UnixNano()
+		stored = &stamped{Item: item, inserted: now, accessed: now}
+	}
+	n = t.mutable(n)
+	if len(children) == 0 || (right == len(children)-1 &&
+		r >= children[right].remainder) {
+		n.insertChild(len(children), newNode(stored, r, t.owner))
 	} else {
-		n.children.insert(right, child)
+		n.insertChild(right, newNode(stored, r, t.owner))
 	}
 	t.length++
-	return child.item
+	t.generation++
+	if t.appender != nil {
+		t.appender.append(recordPut, item)
+	}
+	if t.changes != nil {
+		t.track(p.key)
+	}
+	if t.index != nil {
+		t.indexInsert(p.key)
+	}
+	if t.secondaries != nil {
+		t.secondaryInsert(item)
+	}
+	t.inserts[depth]++
+	t.levels[depth]++
+	if int(depth+1) > t.height {
+		t.height = int(depth + 1)
+	}
+	return item, n
 }
 
 // delete finds node by item recursively, if found, deletes it and
-// returns the item, else nil.
-func (t *HTree) delete(n *node, item Item) Item {
-	r := modulo(item.Key(), n.depth)
-	ok, left, _ := n.children.search(r)
+// returns the item, else nil. The node n is returned as well, or its
+// copy if it's modified but not owned by the tree.
+func (t *HTree) delete(n *node, depth int8, p *KeyPath) (Item, *node) {
+	r := p.rs[depth]
+	children := n.children()
+	ok, left, _ := children.search(r)
 	if ok {
 		// Get the child with the same remaider.
-		child := n.children[left]
-		if child.item.Key() == item.Key() {
-			if len(child.children) == 0 {
+		child := children[left]
+		if child.item.Key() == p.key {
+			n = t.mutable(n)
+			if len(child.children()) == 0 {
 				// Delete child directly.
-				n.children.delete(left)
+				n.deleteChild(left)
+				t.leave(depth + 1)
 			} else {
-				// Find the leaf on this branch.
-				father := child
-				leaf := father.children[0]
-				for {
-					if len(leaf.children) == 0 {
-						break
-					}
-					father = leaf
-					leaf = father.children[0]
-				}
+				// Take the first leaf on this branch.
+				leaf, leafDepth, c := t.popLeaf(child, depth+1)
+				t.leave(leafDepth)
 				// Replace child with new node.
-				father.children.delete(0)
-				n.children[left] = newNode(leaf.item, child.depth, child.remainder)
-				n.children[left].children = child.children
+				replace := newNode(leaf.item, child.remainder, t.owner)
+				replace.adopt(c.children())
+				n.children()[left] = replace
 			}
-			t.length--
-			return child.item
+			t.removed(child.value())
+			return child.value(), n
 		}
-		return t.delete(child, item)
+		result, c := t.delete(child, depth+1, p)
+		if c != child {
+			n = t.mutable(n)
+			n.children()[left] = c
+		}
+		return result, n
 	}
-	return nil
+	return nil, n
 }
 
-// Get item from htree, nil if not found.
+// replace finds the node with the key recursively and replaces its item
+// in place, returns the old item, nil if not found. The node n is returned
+// as well, or its copy if it's modified but not owned by the tree.
+func (t *HTree) replace(n *node, depth int8, p *KeyPath, item Item) (Item, *node) {
+	r := p.rs[depth]
+	children := n.children()
+	ok, left, _ := children.search(r)
+	if !ok {
+		return nil, n
+	}
+	child := children[left]
+	var result Item
+	var c *node
+	if child.item.Key() == p.key {
+		result = child.value()
+		c = t.mutable(child)
+		c.item = item
+		if s, ok := child.item.(*stamped); ok {
+			now := t.clock.Now().UnixNano()
+			c.item = &stamped{Item: item, inserted: s.inserted, accessed: now}
+		}
+		t.replaced(result, item)
+	} else {
+		result, c = t.replace(child, depth+1, p, item)
+	}
+	if c != child {
+		n = t.mutable(n)
+		n.children()[left] = c
+	}
+	return result, n
+}
+
+// replaced updates the counters and the optional companions on an item
+// replaced by another with the same key.
+func (t *HTree) replaced(old, item Item) {
+	t.generation++
+	if t.appender != nil {
+		t.appender.append(recordPut, item)
+	}
+	if t.changes != nil {
+		t.track(item.Key())
+	}
+	if t.secondaries != nil {
+		t.secondaryDelete(old)
+		t.secondaryInsert(item)
+	}
+}
+
+// removed updates the counters and the optional companions on an item
+// removed from the tree.
+func (t *HTree) removed(item Item) {
+	t.length--
+	t.generation++
+	if t.appender != nil {
+		t.appender.append(recordDelete, item)
+	}
+	if t.changes != nil {
+		t.track(item.Key())
+	}
+	if t.index != nil {
+		t.indexDelete(item.Key())
+	}
+	if t.secondaries != nil {
+		t.secondaryDelete(item)
+	}
+}
+
+// popLeaf removes the first leaf on the branch of node n, returns the
+// leaf and its depth, and the node n or its copy if it's not owned by
+// the tree. The depth is of node n.
+func (t *HTree) popLeaf(n *node, depth int8) (*node, int8, *node) {
+	n = t.mutable(n)
+	child := n.children()[0]
+	if len(child.children()) == 0 {
+		n.deleteChild(0)
+		return child, depth + 1, n
+	}
+	leaf, leafDepth, c := t.popLeaf(child, depth+1)
+	n.children()[0] = c
+	return leaf, leafDepth, n
+}
+
+// Get item from htree, nil if not found. Get doesn't allocate, but the
+// conversion of a probe value to Item at the call site may, use GetKey to
+// look up by a raw key instead.
 func (t *HTree) Get(item Item) Item {
-	return t.get(t.root, item)
+	return t.GetPath(NewKeyPath(item.Key()))
+}
+
+// GetKey gets the item with the key from htree, nil if not found.
+func (t *HTree) GetKey(key uint32) Item {
+	return t.GetPath(NewKeyPath(key))
+}
+
+// GetPath is like Get, but takes the precomputed key path.
+func (t *HTree) GetPath(p KeyPath) Item {
+	if t.instrument != nil {
+		return t.observe(OpGet, &p, func() Item { return t.getPath(&p) })
+	}
+	return t.getPath(&p)
+}
+
+// getPath gets the item on the key path.
+func (t *HTree) getPath(p *KeyPath) Item {
+	n := t.get(t.root, 0, p)
+	if t.probes != nil {
+		t.probe(OpGet, p)
+	}
+	if n == nil {
+		return nil
+	}
+	if !t.frozen {
+		t.touch(n)
+	}
+	return n.value()
 }
 
 // Put item into htree and returns the item. If the item already in the
 /// tree, return it, else new a node with the given item and return this
 // item. If the depth overflows, nil is returned.
 func (t *HTree) Put(item Item) Item {
-	return t.put(t.root, item)
+	return t.PutPath(NewKeyPath(item.Key()), item)
+}
+
+// PutPath is like Put, but takes the precomputed key path, which must be
+// the path of the item's key.
+func (t *HTree) PutPath(p KeyPath, item Item) Item {
+	if t.frozen {
+		panic(ErrFrozen)
+	}
+	if t.instrument != nil {
+		return t.observe(OpPut, &p, func() Item { return t.putPath(&p, item) })
+	}
+	return t.putPath(&p, item)
+}
+
+// putPath puts the item on the key path.
+func (t *HTree) putPath(p *KeyPath, item Item) Item {
+	result, root := t.put(t.root, 0, p, item)
+	t.root = root
+	if t.probes != nil {
+		t.probe(OpPut, p)
+	}
+	return result
+}
+
+// Replace puts the item in place of the one with the same key and returns
+// the replaced item, nil if not found and nothing is changed. Unlike a
+// delete followed by a put, it never overflows.
+func (t *HTree) Replace(item Item) Item {
+	p := NewKeyPath(item.Key())
+	return t.replacePath(&p, item)
+}
+
+// replacePath replaces the item on the key path in place, which must be
+// the path of the item's key, returns the old item, nil if not found and
+// nothing is changed. Unlike a delete followed by a put, the item stays on
+// its node, so it never overflows.
+func (t *HTree) replacePath(p *KeyPath, item Item) Item {
+	if t.frozen {
+		panic(ErrFrozen)
+	}
+	result, root := t.replace(t.root, 0, p, item)
+	t.root = root
+	return result
 }
 
 // Delete item from htree and returns the item, nil on not found.
 func (t *HTree) Delete(item Item) Item {
-	return t.delete(t.root, item)
+	return t.DeletePath(NewKeyPath(item.Key()))
+}
+
+// DeletePath is like Delete, but takes the precomputed key path.
+func (t *HTree) DeletePath(p KeyPath) Item {
+	if t.frozen {
+		panic(ErrFrozen)
+	}
+	if t.instrument != nil {
+		return t.observe(OpDelete, &p, func() Item { return t.deletePath(&p) })
+	}
+	return t.deletePath(&p)
+}
+
+// deletePath deletes the item on the key path.
+func (t *HTree) deletePath(p *KeyPath) Item {
+	result, root := t.delete(t.root, 0, p)
+	t.root = root
+	return result
+}
+
+// CloneCOW returns a shallow copy of the htree, which shares all nodes with
+// the original, the nodes on the path are copied lazily on the first
+// modification of either tree. The clone is not frozen even if the original
+// is, and doesn't write to the appender. Access timestamps of the shared
+// items are shared as well.
+func (t *HTree) CloneCOW() *HTree {
+	c := *t
+	c.frozen = false
+	c.appender = nil
+	c.owner = atomic.AddUint32(&owners, 1)
+	if !t.frozen {
+		// A frozen tree never modifies its nodes, let it keep the ownership.
+		t.owner = atomic.AddUint32(&owners, 1)
+	}
+	return &c
+}
+
+// Any returns an arbitrary item in the htree, nil if the tree is empty.
+func (t *HTree) Any() Item {
+	if len(t.root.children()) == 0 {
+		return nil
+	}
+	return t.root.children()[0].value()
+}
+
+// walk calls f on the items under node n in the iteration order, returns
+// false if f stops the walking.
+func (t *HTree) walk(n *node, f func(Item) bool) bool {
+	for _, child := range n.children() {
+		if !f(child.value()) || !t.walk(child, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// Walk calls f on each item in the iteration order, stops if f returns false.
+func (t *HTree) Walk(f func(Item) bool) {
+	t.walk(t.root, f)
+}
+
+// CopyTo puts all items into the destination htree, returns the number of
+// items newly inserted into dst.
+func (t *HTree) CopyTo(dst *HTree) int {
+	length := dst.length
+	t.walk(t.root, func(item Item) bool {
+		dst.Put(item)
+		return true
+	})
+	return dst.length - length
+}
+
+// AppendTo appends all items to buf in the iteration order and returns the
+// extended buffer, buf can be reused across calls to avoid allocations.
+func (t *HTree) AppendTo(buf []Item) []Item {
+	t.walk(t.root, func(item Item) bool {
+		buf = append(buf, item)
+		return true
+	})
+	return buf
+}
+
+// count returns the number of items under node n satisfying pred.
+func (t *HTree) count(n *node, pred func(Item) bool) int {
+	k := 0
+	for _, child := range n.children() {
+		if pred(child.value()) {
+			k++
+		}
+		k += t.count(child, pred)
+	}
+	return k
+}
+
+// Count returns the number of items satisfying pred.
+func (t *HTree) Count(pred func(Item) bool) int {
+	return t.count(t.root, pred)
+}
+
+// Nearest returns the item whose key is numerically closest to the key,
+// the smaller one on ties, nil if the tree is empty. The keys are not
+// ordered in the tree, if the key itself is missing, all items are scanned
+// unless the tree has the ordered index.
+func (t *HTree) Nearest(key uint32) Item {
+	if t.index != nil {
+		floor, ceil := t.Floor(key), t.Ceil(key)
+		if floor == nil || (ceil != nil && ceil.Key()-key < key-floor.Key()) {
+			return ceil
+		}
+		return floor
+	}
+	if item := t.GetKey(key); item != nil {
+		return item
+	}
+	var (
+		nearest Item
+		best    uint32
+	)
+	t.walk(t.root, func(item Item) bool {
+		k := item.Key()
+		d := k - key
+		if k < key {
+			d = key - k
+		}
+		if nearest == nil || d < best || (d == best && k < nearest.Key()) {
+			nearest, best = item, d
+		}
+		return true
+	})
+	return nearest
+}
+
+// MatchMask calls f on each item whose key&mask == pattern in the iteration
+// order, stops if f returns false. The keys are not indexed by bits, but
+// the root branches are split by the lowest bit, so a mask covering it
+// visits only half of the tree.
+func (t *HTree) MatchMask(mask, pattern uint32, f func(Item) bool) {
+	if pattern&^mask != 0 {
+		return // never matches
+	}
+	match := func(item Item) bool {
+		if item.Key()&mask == pattern {
+			return f(item)
+		}
+		return true
+	}
+	if mask&1 == 0 {
+		t.walk(t.root, match)
+		return
+	}
+	children := t.root.children()
+	if ok, i, _ := children.search(int8(pattern & 1)); ok {
+		child := children[i]
+		if match(child.value()) {
+			t.walk(child, match)
+		}
+	}
+}
+
+// Number of items to walk between two context checks.
+const walkCheckInterval = 1024
+
+// WalkCtx is like Walk, but checks the context periodically and returns
+// ctx.Err() once it's done.
+func (t *HTree) WalkCtx(ctx context.Context, f func(Item) bool) error {
+	var err error
+	i := 0
+	t.walk(t.root, func(item Item) bool {
+		if i%walkCheckInterval == 0 {
+			if err = ctx.Err(); err != nil {
+				return false
+			}
+		}
+		i++
+		return f(item)
+	})
+	return err
 }
 
 // NewIterator returns a new iterator on this htree.
 func (t *HTree) NewIterator() *Iterator {
-	return &Iterator{n: t.root, i: 0, t: t}
+	return &Iterator{n: t.root, i: 0, t: t, total: t.length}
+}
+
+// NewSnapshotIterator returns an iterator over a snapshot of the htree at
+// creation, the iteration is stable even if the tree is modified meanwhile.
+// The snapshot is a frozen CloneCOW, so the tree gives up the ownership of
+// its nodes: each write afterwards copies the nodes on its path the first
+// time, whether or not the iterator is still in use.
+func (t *HTree) NewSnapshotIterator() *Iterator {
+	s := t.CloneCOW()
+	s.Freeze()
+	return s.NewIterator()
 }
 
 // Next seeks the iterator to next.
@@ -288,30 +938,115 @@ func (t *HTree) NewIterator() *Iterator {
 //
 // Order: 0 -> 4 -> 2 -> 1 -> 3 -> 5
 func (iter *Iterator) Next() bool {
-	if len(iter.n.children) > 0 {
-		// Push stack
-		iter.fathers = append(iter.fathers, iter.n)
-		iter.indexes = append(iter.indexes, iter.i)
-		iter.n = iter.n.children[0]
+	if iter.end {
+		return false
+	}
+	if len(iter.n.children()) > 0 {
+		iter.push()
+		iter.n = iter.n.children()[0]
 		iter.i = 0
+		iter.visited++
 		return true
 	}
-	for len(iter.fathers) > 0 {
-		l := len(iter.fathers)
+	// Find the nearest father with a next child, the stack is kept if
+	// there's none, so that Prev can back up from the end.
+	i := iter.i
+	for l := iter.depth; l > 0; l-- {
 		father := iter.fathers[l-1]
-		if iter.i < len(father.children)-1 {
-			iter.i++
-			iter.n = father.children[iter.i]
+		if i < len(father.children())-1 {
+			// Pop stack
+			iter.depth = l
+			iter.i = i + 1
+			iter.n = father.children()[iter.i]
+			iter.visited++
 			return true
 		}
-		// Pop stack
-		iter.fathers, father = iter.fathers[:l-1], iter.fathers[l-1]
-		iter.indexes, iter.i = iter.indexes[:l-1], iter.indexes[l-1]
+		i = iter.indexes[l-1]
 	}
+	iter.end = iter.depth > 0
 	return false
 }
 
+// Prev seeks the iterator to previous, the reverse order of Next. After
+// Next reaches the end, Prev seeks back to the last item.
+func (iter *Iterator) Prev() bool {
+	if iter.end {
+		iter.end = false
+		return true
+	}
+	if iter.depth == 0 {
+		// Before the first item.
+		return false
+	}
+	iter.visited--
+	if iter.i == 0 {
+		// Pop stack
+		iter.depth--
+		iter.n, iter.i = iter.fathers[iter.depth], iter.indexes[iter.depth]
+		return iter.depth > 0
+	}
+	// The last descendant of the previous brother.
+	iter.i--
+	iter.n = iter.fathers[iter.depth-1].children()[iter.i]
+	for len(iter.n.children()) > 0 {
+		iter.push()
+		iter.i = len(iter.n.children()) - 1
+		iter.n = iter.n.children()[iter.i]
+	}
+	return true
+}
+
+// push pushes the current node and its index to the stack.
+func (iter *Iterator) push() {
+	iter.fathers[iter.depth] = iter.n
+	iter.indexes[iter.depth] = iter.i
+	iter.depth++
+}
+
+// Clone returns a copy of the iterator at the same position, the two
+// iterators can then be seeked independently.
+func (iter *Iterator) Clone() *Iterator {
+	c := *iter
+	return &c
+}
+
+// NextChunk seeks the iterator forward and fills dst with up to len(dst)
+// items, returns the number of items filled, 0 on the end of iteration.
+func (iter *Iterator) NextChunk(dst []Item) int {
+	n := 0
+	for n < len(dst) && iter.Next() {
+		dst[n] = iter.n.value()
+		n++
+	}
+	return n
+}
+
+// Progress returns the number of items visited so far and the total number
+// of items in the tree on the iterator's creation.
+func (iter *Iterator) Progress() (visited, total int) {
+	return iter.visited, iter.total
+}
+
 // Item returns the current item.
 func (iter *Iterator) Item() Item {
-	return iter.n.item
+	return iter.n.value()
+}
+
+// InsertedAt returns the insert time of the current item, zero time if the
+// timestamps mode is not enabled.
+func (iter *Iterator) InsertedAt() time.Time {
+	if s, ok := iter.n.item.(*stamped); ok {
+		return time.Unix(0, s.inserted)
+	}
+	return time.Time{}
+}
+
+// AccessedAt returns the last access time of the current item, zero time if
+// the timestamps mode is not enabled. Both Get and Put on an existing key
+// are accesses.
+func (iter *Iterator) AccessedAt() time.Time {
+	if s, ok := iter.n.item.(*stamped); ok {
+		return time.Unix(0, s.accessed)
+	}
+	return time.Time{}
 }
@@ -0,0 +1,115 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// Magic number of the canonical encoding, with the format version.
+var canonicalMagic = [4]byte{'H', 'T', 'C', 1}
+
+// WriteCanonical writes the items in the canonical encoding, which depends
+// only on the set of items and their payloads encoded by enc, but not the
+// insertion order or the tree layout. Trees with equal contents produce
+// identical bytes, so replicas can compare digests, e.g.:
+//
+//	h := sha256.New()
+//	t.WriteCanonical(h, enc)
+//	digest := h.Sum(nil)
+//
+// The encoding is the number of items followed by a put record of each
+// item in ascending key order.
+func (t *HTree) WriteCanonical(w io.Writer, enc func(Item) ([]byte, error)) error {
+	var items []Item
+	if t.index != nil {
+		items = make([]Item, 0, t.length)
+		for _, b := range t.index.blocks {
+			for _, key := range b.keys {
+				p := NewKeyPath(key)
+				items = append(items, t.get(t.root, 0, &p).value())
+			}
+		}
+	} else {
+		items = t.AppendTo(make([]Item, 0, t.length))
+		sort.Slice(items, func(i, j int) bool { return items[i].Key() < items[j].Key() })
+	}
+	bw := bufio.NewWriter(w)
+	b := append([]byte(nil), canonicalMagic[:]...)
+	b = binary.AppendUvarint(b, uint64(len(items)))
+	for _, item := range items {
+		payload, err := enc(item)
+		if err != nil {
+			return err
+		}
+		b = appendRecord(b, recordPut, item.Key(), payload)
+		if _, err := bw.Write(b); err != nil {
+			return err
+		}
+		b = b[:0]
+	}
+	b = appendRecord(b, recordEnd, 0, nil)
+	if _, err := bw.Write(b); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ReadCanonical reads the items written by WriteCanonical and puts them,
+// the items are decoded by dec, the payload is reused across calls. It
+// returns the number of items newly inserted. Non-canonical inputs, e.g.
+// out of order keys, and items decoded with other keys are rejected with
+// ErrCorrupt, an item overflowing the depth with ErrDepthOverflow, the
+// items before are kept.
+func (t *HTree) ReadCanonical(r io.Reader, dec func(key uint32, payload []byte) (Item, error)) (int, error) {
+	br := bufio.NewReader(r)
+	length := t.length
+	var magic [4]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return 0, noEOF(err)
+	}
+	if magic != canonicalMagic {
+		return 0, ErrCorrupt
+	}
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, noEOF(err)
+	}
+	var (
+		buf  []byte
+		prev int64 = -1
+		n    uint64
+	)
+	for {
+		op, key, payload, err := readRecord(br, buf)
+		if err != nil {
+			return t.length - length, noEOF(err)
+		}
+		if op == recordEnd {
+			break
+		}
+		if op != recordPut || int64(key) <= prev || n == count {
+			return t.length - length, ErrCorrupt
+		}
+		buf = payload
+		item, err := dec(key, payload)
+		if err != nil {
+			return t.length - length, err
+		}
+		if item == nil || item.Key() != key {
+			return t.length - length, ErrCorrupt
+		}
+		if t.PutPath(NewKeyPath(key), item) == nil {
+			return t.length - length, ErrDepthOverflow
+		}
+		prev = int64(key)
+		n++
+	}
+	if n != count {
+		return t.length - length, ErrCorrupt
+	}
+	return t.length - length, nil
+}
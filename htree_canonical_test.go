@@ -0,0 +1,79 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestWriteCanonical(t *testing.T) {
+	keys := rand.Perm(2000)
+	a, b, c := New(), New(WithOrderedIndex()), New()
+	for _, key := range keys {
+		a.Put(csvItem{uint32(key), strconv.Itoa(key)})
+	}
+	// Another insertion order, and deletes.
+	for i := len(keys) - 1; i >= 0; i-- {
+		b.Put(csvItem{uint32(keys[i]), strconv.Itoa(keys[i])})
+		b.Put(csvItem{uint32(keys[i] + 5000), "x"})
+	}
+	for _, key := range keys {
+		b.Delete(Uint32(key + 5000))
+	}
+	digest := func(tree *HTree) []byte {
+		h := sha256.New()
+		Must(t, tree.WriteCanonical(h, encodeCSVPayload) == nil)
+		return h.Sum(nil)
+	}
+	Must(t, bytes.Equal(digest(a), digest(b)))
+	a.Delete(Uint32(keys[0]))
+	Must(t, !bytes.Equal(digest(a), digest(b)))
+
+	var buf bytes.Buffer
+	Must(t, b.WriteCanonical(&buf, encodeCSVPayload) == nil)
+	n, err := c.ReadCanonical(&buf, decodeCSVPayload)
+	Must(t, err == nil && n == 2000)
+	Must(t, bytes.Equal(digest(b), digest(c)))
+}
+
+func TestReadCanonicalCorrupt(t *testing.T) {
+	var data []byte
+	data = append(data, canonicalMagic[:]...)
+	data = append(data, 2)
+	data = appendRecord(data, recordPut, 2, []byte("a"))
+	data = appendRecord(data, recordPut, 1, []byte("b"))
+	data = appendRecord(data, recordEnd, 0, nil)
+	tree := New()
+	n, err := tree.ReadCanonical(bytes.NewReader(data), decodeCSVPayload)
+	Must(t, n == 1 && err == ErrCorrupt)
+	// Count mismatch.
+	data[4] = 3
+	data = append(data[:9], appendRecord(nil, recordEnd, 0, nil)...)
+	_, err = New().ReadCanonical(bytes.NewReader(data), decodeCSVPayload)
+	Must(t, err == ErrCorrupt)
+}
+
+func TestReadCanonicalKeys(t *testing.T) {
+	// Keys sharing all the remainders of the first 9 primes.
+	step := uint32(2 * 3 * 5 * 7 * 11 * 13 * 17 * 19 * 23)
+	var data []byte
+	data = append(data, canonicalMagic[:]...)
+	data = append(data, 10)
+	for i := uint32(0); i < 10; i++ {
+		data = appendRecord(data, recordPut, i*step, []byte("a"))
+	}
+	data = appendRecord(data, recordEnd, 0, nil)
+	// Decoded with another key.
+	tree := New()
+	n, err := tree.ReadCanonical(bytes.NewReader(data), func(key uint32, payload []byte) (Item, error) {
+		return csvItem{key + 1, string(payload)}, nil
+	})
+	Must(t, n == 0 && err == ErrCorrupt && tree.Len() == 0)
+	// The last one overflows.
+	n, err = tree.ReadCanonical(bytes.NewReader(data), decodeCSVPayload)
+	Must(t, n == 9 && err == ErrDepthOverflow)
+}
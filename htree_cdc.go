@@ -0,0 +1,209 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// The sync marker frame in the change logs: the length, the op and a magic.
+var syncMarker = []byte{9, recordSync, 'H', 'T', 'C', 'D', 'C', 0xa5, 0x5a, 0x01}
+
+// Appender writes the inserts and deletes of a htree to a change log, for
+// downstream consumers to replicate the tree asynchronously, see Tailer.
+// Each change is a record of the op, key and payload, prefixed by its
+// length. A sync marker is written every few records, and the writer is
+// synced if it has a Sync method, e.g. *os.File.
+//
+// Appending never fails the tree operations, the first write error stops
+// the appender and is reported by Err.
+type Appender struct {
+	w     io.Writer
+	enc   func(Item) ([]byte, error)
+	every int // records between sync markers
+	n     int // records since the last sync marker
+	buf   []byte
+	err   error
+}
+
+// NewAppender creates an appender writing to w, the payloads of the items
+// are encoded by enc, and a sync marker is written every given number of
+// records, never if it's 0.
+func NewAppender(w io.Writer, enc func(Item) ([]byte, error), every int) *Appender {
+	return &Appender{w: w, enc: enc, every: every}
+}
+
+// WithAppender writes the inserts and deletes of the tree to the appender.
+// Clones by CloneCOW don't write to the appender.
+func WithAppender(a *Appender) Option {
+	return func(t *HTree) { t.appender = a }
+}
+
+// Err returns the first error of the appender.
+func (a *Appender) Err() error { return a.err }
+
+// append writes a change record.
+func (a *Appender) append(op byte, item Item) {
+	if a.err != nil {
+		return
+	}
+	var payload []byte
+	if op == recordPut {
+		if payload, a.err = a.enc(item); a.err != nil {
+			return
+		}
+	}
+	// Reserve the max length prefix, and move the record after the actual
+	// one.
+	b := append(a.buf[:0], make([]byte, binary.MaxVarintLen64)...)
+	b = appendRecord(b, op, item.Key(), payload)
+	size := len(b) - binary.MaxVarintLen64
+	n := binary.PutUvarint(b, uint64(size))
+	copy(b[n:], b[binary.MaxVarintLen64:])
+	a.buf = b
+	if _, a.err = a.w.Write(b[:n+size]); a.err != nil {
+		return
+	}
+	if a.n++; a.every > 0 && a.n >= a.every {
+		a.Sync()
+	}
+}
+
+// Sync writes a sync marker, and syncs the writer if it has a Sync method.
+func (a *Appender) Sync() error {
+	if a.err != nil {
+		return a.err
+	}
+	a.n = 0
+	if _, a.err = a.w.Write(syncMarker); a.err != nil {
+		return a.err
+	}
+	if s, ok := a.w.(interface{ Sync() error }); ok {
+		a.err = s.Sync()
+	}
+	return a.err
+}
+
+// Change is a change read from a change log.
+type Change struct {
+	Op      Op     // OpPut or OpDelete
+	Key     uint32 // key of the item
+	Payload []byte // encoded item of puts
+}
+
+// Apply applies the change to the tree, the item of a put is decoded by
+// dec and replaces the existing one in place. It returns ErrCorrupt if the
+// item is decoded with another key, and ErrDepthOverflow if the item can't
+// be put.
+func (t *HTree) Apply(c Change, dec func(key uint32, payload []byte) (Item, error)) error {
+	op := recordDelete
+	if c.Op == OpPut {
+		op = recordPut
+	}
+	return t.applyRecord(op, c.Key, c.Payload, dec)
+}
+
+// Tailer reads the changes from a change log written by an Appender, it
+// tails the log: reads return io.EOF at the end of the log, and can be
+// retried once it grows. A partially written record at the end is kept
+// till the rest arrives.
+type Tailer struct {
+	r    io.Reader
+	buf  []byte // read but not consumed
+	off  int    // offset of the unconsumed bytes in buf
+	lost bool   // skipping to the next sync marker
+}
+
+// NewTailer creates a tailer reading from r.
+func NewTailer(r io.Reader) *Tailer {
+	return &Tailer{r: r}
+}
+
+// Next returns the next change, io.EOF if there is none yet. On corrupt
+// bytes, it returns ErrCorrupt, and the following calls skip to the next
+// sync marker, the changes in between are lost. The payload is valid till
+// the next call.
+func (t *Tailer) Next() (Change, error) {
+	for {
+		if t.lost && !t.skip() {
+			if err := t.fill(); err != nil {
+				return Change{}, err
+			}
+			continue
+		}
+		b := t.buf[t.off:]
+		size, n := binary.Uvarint(b)
+		switch {
+		case n < 0 || size > maxPayload+2*binary.MaxVarintLen64:
+			return Change{}, t.corrupt()
+		case n > 0 && uint64(len(b)-n) >= size:
+			frame := b[:n+int(size)]
+			record := frame[n:]
+			if len(record) > 0 && record[0] == recordSync {
+				if !bytes.Equal(frame, syncMarker) {
+					return Change{}, t.corrupt()
+				}
+				t.off += len(frame)
+				continue
+			}
+			op, key, payload, err := decodeRecord(record)
+			if err != nil {
+				return Change{}, t.corrupt()
+			}
+			t.off += len(frame)
+			c := Change{Op: OpPut, Key: key, Payload: payload}
+			if op == recordDelete {
+				c.Op = OpDelete
+			}
+			return c, nil
+		}
+		// Incomplete, read more.
+		if err := t.fill(); err != nil {
+			return Change{}, err
+		}
+	}
+}
+
+// fill reads more bytes from the log.
+func (t *Tailer) fill() error {
+	// Move the unconsumed bytes to the front.
+	n := copy(t.buf, t.buf[t.off:])
+	t.buf, t.off = t.buf[:n], 0
+	if len(t.buf) == cap(t.buf) {
+		t.buf = append(t.buf, make([]byte, len(t.buf)+4096)...)[:n]
+	}
+	m, err := t.r.Read(t.buf[n:cap(t.buf)])
+	t.buf = t.buf[:n+m]
+	if m > 0 {
+		return nil
+	}
+	if err == nil {
+		err = io.ErrNoProgress
+	}
+	return err
+}
+
+// corrupt skips the corrupt byte and starts skipping to the next sync
+// marker.
+func (t *Tailer) corrupt() error {
+	t.off++
+	t.lost = true
+	return ErrCorrupt
+}
+
+// skip skips the bytes to the next sync marker, reports whether it's found.
+// Otherwise the bytes are skipped but a possible partial marker at the end.
+func (t *Tailer) skip() bool {
+	b := t.buf[t.off:]
+	if i := bytes.Index(b, syncMarker); i >= 0 {
+		t.off += i + len(syncMarker)
+		t.lost = false
+		return true
+	}
+	if keep := len(syncMarker) - 1; len(b) > keep {
+		t.off += len(b) - keep
+	}
+	return false
+}
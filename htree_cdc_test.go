@@ -0,0 +1,148 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// growingReader reads the first n bytes of data, n grows by the test.
+type growingReader struct {
+	data []byte
+	n    int
+	off  int
+}
+
+func (r *growingReader) Read(p []byte) (int, error) {
+	if r.off >= r.n {
+		return 0, io.EOF
+	}
+	k := copy(p, r.data[r.off:r.n])
+	r.off += k
+	return k, nil
+}
+
+// syncWriter counts the syncs.
+type syncWriter struct {
+	bytes.Buffer
+	syncs int
+}
+
+func (w *syncWriter) Sync() error {
+	w.syncs++
+	return nil
+}
+
+// replay applies all the changes available to the tree.
+func replay(t *testing.T, tailer *Tailer, tree *HTree) int {
+	n := 0
+	for {
+		c, err := tailer.Next()
+		if err == io.EOF {
+			return n
+		}
+		Must(t, err == nil)
+		Must(t, tree.Apply(c, decodeCSVPayload) == nil)
+		n++
+	}
+}
+
+func TestAppender(t *testing.T) {
+	w := &syncWriter{}
+	a := NewAppender(w, encodeCSVPayload, 10)
+	src := New(WithAppender(a))
+	dst := New()
+	tailer := NewTailer(&w.Buffer)
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 300; i++ {
+			key := uint32(rand.Intn(500))
+			if rand.Intn(3) == 0 {
+				src.Delete(Uint32(key))
+			} else {
+				src.Put(csvItem{key, "v"})
+			}
+		}
+		replay(t, tailer, dst)
+		Must(t, dst.Len() == src.Len())
+		src.Walk(func(item Item) bool {
+			Must(t, dst.GetKey(item.Key()) == item)
+			return true
+		})
+	}
+	Must(t, a.Err() == nil)
+	Must(t, w.syncs == int(src.Generation()/10))
+	// Clones don't append.
+	n := w.Len()
+	src.CloneCOW().Put(csvItem{1000, "v"})
+	Must(t, w.Len() == n)
+}
+
+func TestTailerPartial(t *testing.T) {
+	var buf bytes.Buffer
+	tree := New(WithAppender(NewAppender(&buf, encodeCSVPayload, 2)))
+	for i := 0; i < 5; i++ {
+		tree.Put(csvItem{uint32(i), "value"})
+	}
+	r := &growingReader{data: buf.Bytes()}
+	tailer := NewTailer(r)
+	dst := New()
+	total := 0
+	// The log grows byte by byte.
+	for r.n = 0; r.n <= len(r.data); r.n++ {
+		total += replay(t, tailer, dst)
+	}
+	Must(t, total == 5)
+	Must(t, dst.Len() == 5)
+}
+
+func TestTailerCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	a := NewAppender(&buf, encodeCSVPayload, 0)
+	tree := New(WithAppender(a))
+	tree.Put(csvItem{1, "a"})
+	tree.Put(csvItem{2, "b"})
+	mid := buf.Len()
+	tree.Put(csvItem{3, "c"})
+	Must(t, a.Sync() == nil)
+	tree.Put(csvItem{4, "d"})
+	data := buf.Bytes()
+	data[mid+1] = 0x7f // corrupt the op of the third
+	tailer := NewTailer(bytes.NewReader(data))
+	var keys []uint32
+	corrupts := 0
+	for {
+		c, err := tailer.Next()
+		if err == io.EOF {
+			break
+		}
+		if err == ErrCorrupt {
+			corrupts++
+			continue
+		}
+		Must(t, err == nil)
+		keys = append(keys, c.Key)
+	}
+	Must(t, corrupts == 1)
+	Must(t, len(keys) == 3 && keys[0] == 1 && keys[1] == 2 && keys[2] == 4)
+}
+
+// failWriter fails all writes.
+type failWriter struct{}
+
+var errWrite = errors.New("write")
+
+func (failWriter) Write(p []byte) (int, error) { return 0, errWrite }
+
+func TestAppenderError(t *testing.T) {
+	a := NewAppender(failWriter{}, encodeCSVPayload, 1)
+	tree := New(WithAppender(a))
+	tree.Put(csvItem{1, "a"})
+	tree.Put(csvItem{2, "b"})
+	Must(t, tree.Len() == 2)
+	Must(t, a.Err() == errWrite)
+	Must(t, a.Sync() == errWrite)
+}
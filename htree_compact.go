@@ -0,0 +1,222 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+// Number of children block classes of the compact htree, the blocks of
+// class c hold 1<<c children, up to 32, more than the largest prime.
+const blockClasses = 6
+
+// cnode is a node in the compact htree, its children are indexes into the
+// node table, stored in a block of the children pool.
+type cnode struct {
+	item      Item
+	first     uint32 // offset of the children block in the pool
+	remainder int8
+	size      int8 // number of children, ordered by remainder
+	class     int8 // class of the children block, if size > 0
+}
+
+// Compact is a hash-tree variant storing all nodes in a per-tree table, and
+// all children in a shared pool of 32-bit indexes into the table, a node
+// addresses its children by an offset and a count. It saves the pointers,
+// the slice headers and the per-node allocations, which makes a node 24
+// bytes on 64-bit platforms, half of a HTree node, and the garbage
+// collector scans a single table.
+//
+// Compact only supports the basic operations. The table and the pool grow
+// by appending, slots of deleted nodes and freed children blocks are reused
+// by later inserts.
+type Compact struct {
+	nodes  []cnode                // node table, the root at 0
+	free   []uint32               // free slots in the table
+	pool   []uint32               // children blocks
+	blocks [blockClasses][]uint32 // free blocks in the pool by class
+	length int                    // number of nodes
+}
+
+// NewCompact creates a new compact htree.
+func NewCompact() *Compact {
+	return &Compact{nodes: make([]cnode, 1)}
+}
+
+// Len returns the number of nodes in the tree.
+func (t *Compact) Len() int { return t.length }
+
+// children returns the children of node n, which refers to the pool.
+func (t *Compact) children(n uint32) []uint32 {
+	node := &t.nodes[n]
+	return t.pool[node.first : node.first+uint32(node.size)]
+}
+
+// search child by remainder via binary-search, returns the result and the
+// position to insert if not found.
+func (t *Compact) search(children []uint32, r int8) (bool, int) {
+	left, right := 0, len(children)
+	for left < right {
+		mid := (left + right) >> 1
+		if t.nodes[children[mid]].remainder < r {
+			left = mid + 1
+		} else {
+			right = mid
+		}
+	}
+	return left < len(children) && t.nodes[children[left]].remainder == r, left
+}
+
+// alloc takes a free slot in the table for the item.
+func (t *Compact) alloc(item Item, r int8) uint32 {
+	n := cnode{item: item, remainder: r}
+	if l := len(t.free); l > 0 {
+		i := t.free[l-1]
+		t.free = t.free[:l-1]
+		t.nodes[i] = n
+		return i
+	}
+	t.nodes = append(t.nodes, n)
+	return uint32(len(t.nodes) - 1)
+}
+
+// release puts the slot back to the free list.
+func (t *Compact) release(i uint32) {
+	t.nodes[i] = cnode{}
+	t.free = append(t.free, i)
+}
+
+// allocBlock takes a free block of the class in the pool, grows the pool
+// if there is none.
+func (t *Compact) allocBlock(class int8) uint32 {
+	if l := len(t.blocks[class]); l > 0 {
+		first := t.blocks[class][l-1]
+		t.blocks[class] = t.blocks[class][:l-1]
+		return first
+	}
+	first := uint32(len(t.pool))
+	t.pool = append(t.pool, make([]uint32, 1<<class)...)
+	return first
+}
+
+// insertChild inserts the child at position i of node n's children, moves
+// the children to a larger block if the block is full.
+func (t *Compact) insertChild(n uint32, i int, child uint32) {
+	node := &t.nodes[n]
+	switch {
+	case node.size == 0:
+		node.class = 0
+		node.first = t.allocBlock(0)
+	case int(node.size) == 1<<node.class:
+		// allocBlock may grow the pool, take the children after it.
+		first := t.allocBlock(node.class + 1)
+		copy(t.pool[first:], t.children(n))
+		t.blocks[node.class] = append(t.blocks[node.class], node.first)
+		node.first = first
+		node.class++
+	}
+	node.size++
+	children := t.children(n)
+	copy(children[i+1:], children[i:])
+	children[i] = child
+}
+
+// deleteChild deletes the child at position i of node n's children, frees
+// the block if it's empty then.
+func (t *Compact) deleteChild(n uint32, i int) {
+	node := &t.nodes[n]
+	children := t.children(n)
+	copy(children[i:], children[i+1:])
+	node.size--
+	if node.size == 0 {
+		t.blocks[node.class] = append(t.blocks[node.class], node.first)
+	}
+}
+
+// Get item from the tree, nil if not found.
+func (t *Compact) Get(item Item) Item {
+	key := item.Key()
+	n := uint32(0)
+	for depth := 0; depth < len(primes); depth++ {
+		children := t.children(n)
+		ok, i := t.search(children, modulo(key, int8(depth)))
+		if !ok {
+			return nil
+		}
+		n = children[i]
+		if t.nodes[n].item.Key() == key {
+			return t.nodes[n].item
+		}
+	}
+	return nil
+}
+
+// Put item into the tree and returns the item. If the item already in the
+// tree, return it, else new a node with the given item and return this
+// item. If the depth overflows, nil is returned.
+func (t *Compact) Put(item Item) Item {
+	key := item.Key()
+	n := uint32(0)
+	for depth := 0; depth < len(primes)-1; depth++ {
+		r := modulo(key, int8(depth))
+		ok, i := t.search(t.children(n), r)
+		if !ok {
+			t.insertChild(n, i, t.alloc(item, r))
+			t.length++
+			return item
+		}
+		n = t.children(n)[i]
+		if t.nodes[n].item.Key() == key {
+			return t.nodes[n].item // reuse
+		}
+	}
+	return nil // depth overflows
+}
+
+// Delete item from the tree and returns the item, nil on not found.
+func (t *Compact) Delete(item Item) Item {
+	key := item.Key()
+	father := uint32(0)
+	for depth := 0; depth < len(primes); depth++ {
+		children := t.children(father)
+		ok, i := t.search(children, modulo(key, int8(depth)))
+		if !ok {
+			return nil
+		}
+		n := children[i]
+		if t.nodes[n].item.Key() != key {
+			father = n
+			continue
+		}
+		found := t.nodes[n].item
+		if t.nodes[n].size == 0 {
+			// Delete the node directly.
+			t.deleteChild(father, i)
+			t.release(n)
+		} else {
+			// Move the first leaf on this branch up to the node.
+			p, leaf := n, t.children(n)[0]
+			for t.nodes[leaf].size > 0 {
+				p, leaf = leaf, t.children(leaf)[0]
+			}
+			t.deleteChild(p, 0)
+			t.nodes[n].item = t.nodes[leaf].item
+			t.release(leaf)
+		}
+		t.length--
+		return found
+	}
+	return nil
+}
+
+// walk calls f on the items under node n in the iteration order, returns
+// false if f stops the walking.
+func (t *Compact) walk(n uint32, f func(Item) bool) bool {
+	for _, child := range t.children(n) {
+		if !f(t.nodes[child].item) || !t.walk(child, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// Walk calls f on each item in the iteration order, stops if f returns false.
+func (t *Compact) Walk(f func(Item) bool) {
+	t.walk(0, f)
+}
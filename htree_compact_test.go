@@ -0,0 +1,132 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+func TestCompactSameAsHTree(t *testing.T) {
+	tree := New()
+	compact := NewCompact()
+	for i := 0; i < 1024*10; i++ {
+		item := Uint32(rand.Intn(1 << 14))
+		switch rand.Intn(3) {
+		case 0:
+			Must(t, compact.Get(item) == tree.Get(item))
+		case 1:
+			Must(t, compact.Put(item) == tree.Put(item))
+		case 2:
+			Must(t, compact.Delete(item) == tree.Delete(item))
+		}
+		Must(t, compact.Len() == tree.Len())
+	}
+	// Same structure, same order.
+	var items []Item
+	compact.Walk(func(item Item) bool {
+		items = append(items, item)
+		return true
+	})
+	i := 0
+	tree.Walk(func(item Item) bool {
+		Must(t, items[i] == item)
+		i++
+		return true
+	})
+	Must(t, i == len(items))
+}
+
+func TestCompactReuseSlots(t *testing.T) {
+	compact := NewCompact()
+	for i := 0; i < 100; i++ {
+		compact.Put(Uint32(i))
+	}
+	size := len(compact.nodes)
+	for i := 0; i < 50; i++ {
+		Must(t, compact.Delete(Uint32(i)) == Uint32(i))
+	}
+	for i := 100; i < 150; i++ {
+		Must(t, compact.Put(Uint32(i)) == Uint32(i))
+	}
+	Must(t, len(compact.nodes) == size)
+	Must(t, compact.Len() == 100)
+}
+
+func TestCompactReuseBlocks(t *testing.T) {
+	compact := NewCompact()
+	for i := 0; i < 1000; i++ {
+		compact.Put(Uint32(i))
+	}
+	size := len(compact.pool)
+	for j := 0; j < 10; j++ {
+		for i := 0; i < 1000; i++ {
+			Must(t, compact.Delete(Uint32(i)) == Uint32(i))
+		}
+		Must(t, compact.Len() == 0)
+		for i := 0; i < 1000; i++ {
+			Must(t, compact.Put(Uint32(i)) == Uint32(i))
+		}
+	}
+	Must(t, len(compact.pool) == size)
+	for i := 0; i < 1000; i++ {
+		Must(t, compact.Get(Uint32(i)) == Uint32(i))
+	}
+}
+
+func BenchmarkCompactGetLargeTree(b *testing.B) {
+	t := NewCompact()
+	n := 1000 * 1000 // Million
+	for i := 0; i < n; i++ {
+		t.Put(Uint32(rand.Uint32()))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t.Get(Uint32(i))
+	}
+}
+
+// heapBytesPerEntry returns the heap bytes retained per entry by the tree
+// built with n random items by put.
+func heapBytesPerEntry(n int, build func(n int) interface{}) float64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	t := build(n)
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(t)
+	return float64(after.HeapAlloc-before.HeapAlloc) / float64(n)
+}
+
+func BenchmarkCompactMemory(b *testing.B) {
+	n := 1000 * 1000 // Million
+	for _, c := range []struct {
+		name  string
+		build func(n int) interface{}
+	}{
+		{"htree", func(n int) interface{} {
+			t := New()
+			for i := 0; i < n; i++ {
+				t.Put(Uint32(rand.Uint32()))
+			}
+			return t
+		}},
+		{"compact", func(n int) interface{} {
+			t := NewCompact()
+			for i := 0; i < n; i++ {
+				t.Put(Uint32(rand.Uint32()))
+			}
+			return t
+		}},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			var bytes float64
+			for i := 0; i < b.N; i++ {
+				bytes = heapBytesPerEntry(n, c.build)
+			}
+			b.ReportMetric(bytes, "B/entry")
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// ExportCSV writes a CSV record for each item in the iteration order, the
+// fields of an item are encoded by enc.
+func (t *HTree) ExportCSV(w io.Writer, enc func(Item) []string) error {
+	cw := csv.NewWriter(w)
+	var err error
+	t.walk(t.root, func(item Item) bool {
+		err = cw.Write(enc(item))
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ImportCSV reads CSV records till EOF and puts the items decoded by dec,
+// returns the number of items newly inserted. Records may have variable
+// number of fields, the record passed to dec is reused across calls. On a
+// decode error, the items before it are kept and the error reports the
+// line of the record.
+func (t *HTree) ImportCSV(r io.Reader, dec func([]string) (Item, error)) (int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	length := t.length
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return t.length - length, err
+		}
+		item, err := dec(record)
+		if err != nil {
+			line, _ := cr.FieldPos(0)
+			return t.length - length, fmt.Errorf("htree: csv line %d: %w", line, err)
+		}
+		t.Put(item)
+	}
+	return t.length - length, nil
+}
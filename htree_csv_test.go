@@ -0,0 +1,68 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// csvItem is an item with a value for the csv tests.
+type csvItem struct {
+	key   uint32
+	value string
+}
+
+func (item csvItem) Key() uint32 { return item.key }
+
+func encodeCSVItem(item Item) []string {
+	i := item.(csvItem)
+	return []string{strconv.FormatUint(uint64(i.key), 10), i.value}
+}
+
+func decodeCSVItem(record []string) (Item, error) {
+	if len(record) != 2 {
+		return nil, errors.New("want 2 fields")
+	}
+	key, err := strconv.ParseUint(record[0], 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	return csvItem{uint32(key), record[1]}, nil
+}
+
+func TestCSV(t *testing.T) {
+	tree := New()
+	for i := uint32(0); i < 100; i++ {
+		tree.Put(csvItem{i, "v," + strconv.Itoa(int(i))})
+	}
+	var buf bytes.Buffer
+	Must(t, tree.ExportCSV(&buf, encodeCSVItem) == nil)
+	Must(t, strings.HasPrefix(buf.String(), "0,\"v,0\"\n"))
+
+	other := New()
+	n, err := other.ImportCSV(&buf, decodeCSVItem)
+	Must(t, err == nil)
+	Must(t, n == 100)
+	for i := uint32(0); i < 100; i++ {
+		Must(t, other.GetKey(i) == csvItem{i, "v," + strconv.Itoa(int(i))})
+	}
+	// Reimport puts no new items.
+	var again bytes.Buffer
+	tree.ExportCSV(&again, encodeCSVItem)
+	n, err = other.ImportCSV(&again, decodeCSVItem)
+	Must(t, err == nil && n == 0)
+}
+
+func TestImportCSVError(t *testing.T) {
+	tree := New()
+	n, err := tree.ImportCSV(strings.NewReader("1,a\n2,b\n3\n4,d\n"), decodeCSVItem)
+	Must(t, n == 2)
+	Must(t, err != nil && strings.Contains(err.Error(), "line 3"))
+	Must(t, tree.Len() == 2)
+	_, err = tree.ImportCSV(strings.NewReader("5,\"e\n"), decodeCSVItem)
+	Must(t, err != nil)
+}
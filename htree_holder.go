@@ -0,0 +1,55 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Holder holds a htree to be swapped atomically, for read-heavy lookup
+// tables: readers Load the current tree without locks, writers build a new
+// tree and Store it. A stored tree is shared with the readers and must not
+// be modified anymore, freeze it to enforce that.
+//
+// The zero value holds no tree.
+type Holder struct {
+	p  atomic.Pointer[HTree]
+	mu sync.Mutex // serializes writers
+}
+
+// NewHolder creates a holder holding the tree.
+func NewHolder(t *HTree) *Holder {
+	h := &Holder{}
+	h.p.Store(t)
+	return h
+}
+
+// Load returns the current tree, nil if nothing is stored yet.
+func (h *Holder) Load() *HTree { return h.p.Load() }
+
+// Store replaces the current tree with t.
+func (h *Holder) Store(t *HTree) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.p.Store(t)
+}
+
+// Update replaces the current tree with the one returned by f, and returns
+// it. Updates are serialized, so none of them is lost. The tree passed to f
+// is the current one, which may be in use by readers, f should modify a
+// CloneCOW of it instead, e.g.:
+//
+//	h.Update(func(t *HTree) *HTree {
+//		c := t.CloneCOW()
+//		c.Put(item)
+//		c.Freeze()
+//		return c
+//	})
+func (h *Holder) Update(f func(*HTree) *HTree) *HTree {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t := f(h.p.Load())
+	h.p.Store(t)
+	return t
+}
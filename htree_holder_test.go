@@ -0,0 +1,60 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestHolder(t *testing.T) {
+	var zero Holder
+	Must(t, zero.Load() == nil)
+
+	tree := New()
+	tree.Put(Uint32(1))
+	tree.Freeze()
+	h := NewHolder(tree)
+	Must(t, h.Load() == tree)
+	next := h.Update(func(old *HTree) *HTree {
+		c := old.CloneCOW()
+		c.Put(Uint32(2))
+		c.Freeze()
+		return c
+	})
+	Must(t, h.Load() == next)
+	Must(t, next.Len() == 2)
+	Must(t, tree.Len() == 1)
+	h.Store(tree)
+	Must(t, h.Load() == tree)
+}
+
+func TestHolderConcurrentUpdates(t *testing.T) {
+	tree := New()
+	tree.Freeze()
+	h := NewHolder(tree)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				h.Update(func(old *HTree) *HTree {
+					c := old.CloneCOW()
+					c.Put(Uint32(g*100 + i))
+					c.Freeze()
+					return c
+				})
+			}
+		}(g)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				h.Load().Get(Uint32(i))
+			}
+		}()
+	}
+	wg.Wait()
+	Must(t, h.Load().Len() == 800)
+	Must(t, h.Load().Validate() == nil)
+}
@@ -0,0 +1,225 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+var (
+	// ErrNotTracked is returned on saving the changes of a tree without
+	// the change tracking.
+	ErrNotTracked = errors.New("htree: changes not tracked")
+	// ErrChangesForgotten is returned on saving the changes since a
+	// generation already forgotten.
+	ErrChangesForgotten = errors.New("htree: changes forgotten")
+)
+
+// Magic number of the incremental snapshots, with the format version.
+var incrementalMagic = [4]byte{'H', 'T', 'I', 1}
+
+// Average number of keys in a shard of the change log, the shards double
+// beyond it.
+const changeShard = 256
+
+// genShard is a shard of the change log.
+type genShard struct {
+	gens  map[uint32]uint64
+	owner uint32 // id of the tree owning the shard
+}
+
+// changeLog is the generation of the last change of each key, including
+// the deleted keys, sharded by the hash of the keys. Like the ordered index,
+// the log and its shards are shared with the clones and copied on the first
+// modification, a write copies a single shard.
+type changeLog struct {
+	shards []*genShard // power of 2
+	shift  uint        // 32 - log2(len(shards))
+	length int         // number of keys
+	floor  uint64      // changes till this generation are forgotten
+	owner  uint32      // id of the tree owning the log
+}
+
+// newChangeLog creates an empty change log owned by the tree of owner.
+func newChangeLog(floor uint64, owner uint32) *changeLog {
+	s := &genShard{map[uint32]uint64{}, owner}
+	return &changeLog{shards: []*genShard{s}, shift: 32, floor: floor, owner: owner}
+}
+
+// shard returns the shard index of the key, by fibonacci hashing.
+func (c *changeLog) shard(key uint32) uint32 {
+	return key * 2654435769 >> c.shift
+}
+
+// set records the generation of the key, copies the shard if it's not
+// owned. The log must be owned already.
+func (c *changeLog) set(key uint32, gen uint64) {
+	i := c.shard(key)
+	s := c.shards[i]
+	if s.owner != c.owner {
+		gens := make(map[uint32]uint64, len(s.gens)+1)
+		for k, g := range s.gens {
+			gens[k] = g
+		}
+		s = &genShard{gens, c.owner}
+		c.shards[i] = s
+	}
+	if _, ok := s.gens[key]; !ok {
+		c.length++
+	}
+	s.gens[key] = gen
+	if c.length > len(c.shards)*changeShard {
+		c.grow()
+	}
+}
+
+// grow doubles the shards.
+func (c *changeLog) grow() {
+	old := c.shards
+	c.shards = make([]*genShard, 2*len(old))
+	c.shift--
+	for i := range c.shards {
+		c.shards[i] = &genShard{make(map[uint32]uint64, changeShard), c.owner}
+	}
+	for _, s := range old {
+		for k, g := range s.gens {
+			c.shards[c.shard(k)].gens[k] = g
+		}
+	}
+}
+
+// each calls f on each key with the generation of its last change.
+func (c *changeLog) each(f func(key uint32, gen uint64)) {
+	for _, s := range c.shards {
+		for k, g := range s.gens {
+			f(k, g)
+		}
+	}
+}
+
+// WithChangeTracking tracks the generation of the last change of each key
+// for the incremental snapshots, see SaveIncremental. It costs a map entry
+// per key ever changed, till the changes are forgotten by ForgetChanges.
+func WithChangeTracking() Option {
+	return func(t *HTree) { t.changes = newChangeLog(0, 0) }
+}
+
+// track records a change of the key at the current generation.
+func (t *HTree) track(key uint32) {
+	if t.changes.owner != t.owner {
+		c := *t.changes
+		c.shards = append([]*genShard(nil), c.shards...)
+		c.owner = t.owner
+		t.changes = &c
+	}
+	t.changes.set(key, t.generation)
+}
+
+// ForgetChanges drops the tracked changes till the generation, typically
+// the one of a checkpoint already saved, to bound the tracking memory.
+// Incremental snapshots since the dropped generations are not available
+// anymore.
+func (t *HTree) ForgetChanges(gen uint64) {
+	if t.changes == nil || gen <= t.changes.floor {
+		return
+	}
+	c := newChangeLog(gen, t.owner)
+	t.changes.each(func(key uint32, g uint64) {
+		if g > gen {
+			c.set(key, g)
+		}
+	})
+	t.changes = c
+}
+
+// SaveIncremental writes the changes after the generation since, i.e. the
+// items inserted and the keys deleted, with the payloads of the items
+// encoded by enc. It returns the current generation, which is the since of
+// the next incremental snapshot. A since of 0 writes all the items ever
+// changed, which is a full snapshot if no changes are forgotten.
+func (t *HTree) SaveIncremental(w io.Writer, since uint64, enc func(Item) ([]byte, error)) (uint64, error) {
+	if t.changes == nil {
+		return 0, ErrNotTracked
+	}
+	if since < t.changes.floor {
+		return 0, ErrChangesForgotten
+	}
+	var keys []uint32
+	t.changes.each(func(key uint32, gen uint64) {
+		if gen > since {
+			keys = append(keys, key)
+		}
+	})
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	bw := bufio.NewWriter(w)
+	b := append([]byte(nil), incrementalMagic[:]...)
+	b = binary.AppendUvarint(b, since)
+	b = binary.AppendUvarint(b, t.generation)
+	for _, key := range keys {
+		p := NewKeyPath(key)
+		if n := t.get(t.root, 0, &p); n == nil {
+			b = appendRecord(b, recordDelete, key, nil)
+		} else {
+			payload, err := enc(n.value())
+			if err != nil {
+				return 0, err
+			}
+			b = appendRecord(b, recordPut, key, payload)
+		}
+		if _, err := bw.Write(b); err != nil {
+			return 0, err
+		}
+		b = b[:0]
+	}
+	b = appendRecord(b, recordEnd, 0, nil)
+	if _, err := bw.Write(b); err != nil {
+		return 0, err
+	}
+	return t.generation, bw.Flush()
+}
+
+// ApplyIncremental applies an incremental snapshot written by
+// SaveIncremental, the items are decoded by dec from their keys and
+// payloads, the payload is reused across calls. Put records replace the
+// existing items in place. It returns the generation of the source tree the
+// snapshot was saved at. An item decoded with another key is ErrCorrupt,
+// and an item overflowing the depth is ErrDepthOverflow. On an error, the
+// records before it are applied.
+func (t *HTree) ApplyIncremental(r io.Reader, dec func(key uint32, payload []byte) (Item, error)) (uint64, error) {
+	br := bufio.NewReader(r)
+	var magic [4]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return 0, noEOF(err)
+	}
+	if magic != incrementalMagic {
+		return 0, ErrCorrupt
+	}
+	if _, err := binary.ReadUvarint(br); err != nil {
+		return 0, noEOF(err)
+	}
+	until, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, noEOF(err)
+	}
+	var buf []byte
+	for {
+		op, key, payload, err := readRecord(br, buf)
+		if err != nil {
+			return 0, noEOF(err)
+		}
+		switch op {
+		case recordEnd:
+			return until, nil
+		default:
+			buf = payload
+			if err := t.applyRecord(op, key, payload, dec); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func encodeCSVPayload(item Item) ([]byte, error) {
+	return []byte(item.(csvItem).value), nil
+}
+
+func decodeCSVPayload(key uint32, payload []byte) (Item, error) {
+	return csvItem{key, string(payload)}, nil
+}
+
+func TestSaveIncremental(t *testing.T) {
+	src := New(WithChangeTracking())
+	dst := New()
+	var since uint64
+	// Periodic incremental backups.
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 500; i++ {
+			key := uint32(rand.Intn(1000))
+			if rand.Intn(3) == 0 {
+				src.Delete(Uint32(key))
+			} else if src.GetKey(key) == nil {
+				src.Put(csvItem{key, string(rune('a' + round))})
+			}
+		}
+		var buf bytes.Buffer
+		gen, err := src.SaveIncremental(&buf, since, encodeCSVPayload)
+		Must(t, err == nil && gen == src.Generation())
+		until, err := dst.ApplyIncremental(&buf, decodeCSVPayload)
+		Must(t, err == nil && until == gen)
+		since = gen
+		// Same contents.
+		Must(t, dst.Len() == src.Len())
+		src.Walk(func(item Item) bool {
+			Must(t, dst.GetKey(item.Key()) == item)
+			return true
+		})
+	}
+	// Nothing changed since the last checkpoint.
+	var buf bytes.Buffer
+	src.SaveIncremental(&buf, since, encodeCSVPayload)
+	Must(t, buf.Len() == 4+2*len(binary.AppendUvarint(nil, since))+1)
+}
+
+func TestSaveIncrementalReplace(t *testing.T) {
+	src := New(WithChangeTracking())
+	dst := New()
+	src.Put(csvItem{1, "a"})
+	dst.Put(csvItem{1, "old"})
+	dst.Put(csvItem{2, "gone"})
+	src.Put(csvItem{2, "b"})
+	src.Delete(Uint32(2))
+	var buf bytes.Buffer
+	_, err := src.SaveIncremental(&buf, 0, encodeCSVPayload)
+	Must(t, err == nil)
+	_, err = dst.ApplyIncremental(&buf, decodeCSVPayload)
+	Must(t, err == nil)
+	Must(t, dst.GetKey(1) == csvItem{1, "a"})
+	Must(t, dst.GetKey(2) == nil)
+}
+
+func TestForgetChanges(t *testing.T) {
+	tree := New(WithChangeTracking())
+	for i := 0; i < 10; i++ {
+		tree.Put(Uint32(i))
+	}
+	clone := tree.CloneCOW()
+	tree.ForgetChanges(5)
+	Must(t, tree.changes.length == 5)
+	_, err := tree.SaveIncremental(io.Discard, 4, encodeNone)
+	Must(t, err == ErrChangesForgotten)
+	_, err = tree.SaveIncremental(io.Discard, 5, encodeNone)
+	Must(t, err == nil)
+	// The clone keeps its changes.
+	clone.Put(Uint32(100))
+	Must(t, clone.changes.length == 11)
+	Must(t, tree.changes.length == 5)
+	_, err = New().SaveIncremental(io.Discard, 0, encodeNone)
+	Must(t, err == ErrNotTracked)
+}
+
+func encodeNone(Item) ([]byte, error) { return nil, nil }
+
+func TestChangeLogCloneCOW(t *testing.T) {
+	tree := New(WithChangeTracking())
+	for i := 0; i < 10000; i++ {
+		tree.Put(Uint32(i))
+	}
+	Must(t, len(tree.changes.shards) > 1)
+	clone := tree.CloneCOW()
+	clone.Put(Uint32(10000))
+	// A write copies a single shard.
+	shared := 0
+	for i, s := range clone.changes.shards {
+		if s == tree.changes.shards[i] {
+			shared++
+		}
+	}
+	Must(t, shared == len(tree.changes.shards)-1)
+	Must(t, clone.changes.length == 10001 && tree.changes.length == 10000)
+	var buf bytes.Buffer
+	_, err := clone.SaveIncremental(&buf, 0, encodeNone)
+	Must(t, err == nil)
+	dst := New()
+	_, err = dst.ApplyIncremental(&buf, func(key uint32, _ []byte) (Item, error) { return Uint32(key), nil })
+	Must(t, err == nil && dst.Len() == 10001)
+}
+
+func TestApplyIncrementalCorrupt(t *testing.T) {
+	src := New(WithChangeTracking())
+	for i := 0; i < 10; i++ {
+		src.Put(csvItem{uint32(i), "v"})
+	}
+	var buf bytes.Buffer
+	src.SaveIncremental(&buf, 0, encodeCSVPayload)
+	data := buf.Bytes()
+	// Truncated.
+	for _, n := range []int{0, 3, 6, len(data) - 1} {
+		_, err := New().ApplyIncremental(bytes.NewReader(data[:n]), decodeCSVPayload)
+		Must(t, err == io.ErrUnexpectedEOF)
+	}
+	// Bad magic.
+	bad := append([]byte("XXXX"), data[4:]...)
+	_, err := New().ApplyIncremental(bytes.NewReader(bad), decodeCSVPayload)
+	Must(t, err == ErrCorrupt)
+	// Decode error.
+	errDecode := errors.New("decode")
+	_, err = New().ApplyIncremental(bytes.NewReader(data), func(uint32, []byte) (Item, error) {
+		return nil, errDecode
+	})
+	Must(t, err == errDecode)
+	// Decoded with another key.
+	dst := New()
+	_, err = dst.ApplyIncremental(bytes.NewReader(data), func(key uint32, payload []byte) (Item, error) {
+		return csvItem{key + 1, string(payload)}, nil
+	})
+	Must(t, err == ErrCorrupt && dst.Len() == 0)
+}
+
+func TestApplyRecord(t *testing.T) {
+	tree := New()
+	// 2 at depth 1, 0 under it on the first remainder, and the keys sharing
+	// all the remainders of the first 9 primes with 2 on the depths 2 to 9.
+	step := uint32(2 * 3 * 5 * 7 * 11 * 13 * 17 * 19 * 23)
+	keys := []uint32{2, 0}
+	for i := uint32(1); i < 9; i++ {
+		keys = append(keys, 2+i*step)
+	}
+	for _, key := range keys {
+		tree.Put(csvItem{key, "a"})
+	}
+	// Replaced in place, a re-put of 2 would overflow.
+	err := tree.applyRecord(recordPut, 2, []byte("b"), decodeCSVPayload)
+	Must(t, err == nil && tree.GetKey(2) == csvItem{2, "b"})
+	Must(t, tree.Len() == len(keys))
+	err = tree.applyRecord(recordPut, 2+9*step, []byte("b"), decodeCSVPayload)
+	Must(t, err == ErrDepthOverflow)
+	// Decoded with another key.
+	err = tree.applyRecord(recordPut, 3, []byte("b"), func(uint32, []byte) (Item, error) {
+		return csvItem{4, "b"}, nil
+	})
+	Must(t, err == ErrCorrupt && tree.GetKey(3) == nil && tree.GetKey(4) == nil)
+	Must(t, tree.Validate() == nil)
+}
+
+func BenchmarkChangeTrackingRCUPut(b *testing.B) {
+	tree := New(WithChangeTracking())
+	for i := 0; i < 200*1000; i++ {
+		tree.Put(Uint32(rand.Uint32()))
+	}
+	r := NewRCU(tree)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Put(Uint32(rand.Uint32()))
+	}
+}
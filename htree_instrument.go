@@ -0,0 +1,144 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import "time"
+
+// Op is the type of a tree operation.
+type Op int
+
+// Operation types.
+const (
+	OpGet Op = iota
+	OpPut
+	OpDelete
+)
+
+// String returns the name of the operation.
+func (op Op) String() string {
+	switch op {
+	case OpGet:
+		return "get"
+	case OpPut:
+		return "put"
+	case OpDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// OpInfo describes a finished tree operation.
+type OpInfo struct {
+	Op       Op            // operation type
+	Key      uint32        // key operated on
+	Depth    int           // number of levels visited on the key path
+	Start    time.Time     // when the operation started, by the tree clock
+	Duration time.Duration // time taken by the operation
+}
+
+// Instrument observes the operations on a htree, e.g. to emit traces and
+// metrics. The calls are made synchronously on the goroutine operating the
+// tree, so the instrument of a tree read concurrently, e.g. the snapshots
+// of RCU, must be safe for concurrent use.
+type Instrument interface {
+	// BeforeOp is called before the operation starts.
+	BeforeOp(op Op, key uint32)
+	// AfterOp is called after the operation finishes.
+	AfterOp(info OpInfo)
+}
+
+// WithInstrument adds an instrument observing the Get, Put and Delete
+// operations (including the key and path variants), instruments are called
+// in the order added. An instrumented tree walks the key path once more per
+// operation to find the depth reached.
+func WithInstrument(i Instrument) Option {
+	return func(t *HTree) { t.instrument = chain(t.instrument, i) }
+}
+
+// WithSlowOpThreshold reports the operations taking longer than d to the
+// logger, to catch the pathological deep paths in production. The duration
+// is measured by the tree clock.
+func WithSlowOpThreshold(d time.Duration, logger func(OpInfo)) Option {
+	return WithInstrument(slowOps{d, logger})
+}
+
+// instruments calls a list of instruments in order.
+type instruments []Instrument
+
+// BeforeOp calls BeforeOp of all the instruments.
+func (s instruments) BeforeOp(op Op, key uint32) {
+	for _, i := range s {
+		i.BeforeOp(op, key)
+	}
+}
+
+// AfterOp calls AfterOp of all the instruments.
+func (s instruments) AfterOp(info OpInfo) {
+	for _, i := range s {
+		i.AfterOp(info)
+	}
+}
+
+// chain returns an instrument calling a and then b, a may be nil.
+func chain(a, b Instrument) Instrument {
+	switch s := a.(type) {
+	case nil:
+		return b
+	case instruments:
+		return append(s[:len(s):len(s)], b)
+	}
+	return instruments{a, b}
+}
+
+// slowOps is the instrument logging slow operations.
+type slowOps struct {
+	threshold time.Duration
+	logger    func(OpInfo)
+}
+
+// BeforeOp does nothing.
+func (s slowOps) BeforeOp(op Op, key uint32) {}
+
+// AfterOp logs the operation if it's slow.
+func (s slowOps) AfterOp(info OpInfo) {
+	if info.Duration > s.threshold {
+		s.logger(info)
+	}
+}
+
+// reach returns the number of levels visited to look up the key, i.e.
+// the depth of the item if it's in the tree, else the depth the search
+// stopped at.
+func (t *HTree) reach(p *KeyPath) int {
+	n := t.root
+	for depth := 0; depth < len(primes); depth++ {
+		children := n.children()
+		ok, i, _ := children.search(p.rs[depth])
+		if !ok {
+			return depth
+		}
+		n = children[i]
+		if n.item.Key() == p.key {
+			return depth + 1
+		}
+	}
+	return len(primes)
+}
+
+// observe runs the operation f on the key path and reports it to the
+// instrument. The depth of deletes is measured before the item is gone.
+func (t *HTree) observe(op Op, p *KeyPath, f func() Item) Item {
+	t.instrument.BeforeOp(op, p.key)
+	depth := 0
+	if op == OpDelete {
+		depth = t.reach(p)
+	}
+	start := t.clock.Now()
+	result := f()
+	d := t.clock.Now().Sub(start)
+	if op != OpDelete {
+		depth = t.reach(p)
+	}
+	t.instrument.AfterOp(OpInfo{op, p.key, depth, start, d})
+	return result
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"testing"
+	"time"
+)
+
+// recorder is an instrument recording the operations.
+type recorder struct {
+	before []Op
+	after  []OpInfo
+}
+
+func (r *recorder) BeforeOp(op Op, key uint32) { r.before = append(r.before, op) }
+func (r *recorder) AfterOp(info OpInfo)        { r.after = append(r.after, info) }
+
+func TestInstrument(t *testing.T) {
+	r := &recorder{}
+	clock := &fakeClock{time.Unix(100, 0)}
+	tree := New(WithInstrument(r), WithClock(clock))
+	// 0%2=0 at depth 1, 6%2=0 6%3=0 at depth 2.
+	tree.Put(Uint32(0))
+	tree.Put(Uint32(6))
+	Must(t, tree.Get(Uint32(6)) == Uint32(6))
+	Must(t, tree.GetKey(12) == nil)
+	Must(t, tree.Delete(Uint32(6)) == Uint32(6))
+	Must(t, len(r.before) == 5)
+	Must(t, len(r.after) == 5)
+	expects := []OpInfo{
+		{OpPut, 0, 1, time.Unix(100, 0), 0},
+		{OpPut, 6, 2, time.Unix(100, 0), 0},
+		{OpGet, 6, 2, time.Unix(100, 0), 0},
+		{OpGet, 12, 2, time.Unix(100, 0), 0},
+		{OpDelete, 6, 2, time.Unix(100, 0), 0},
+	}
+	for i, info := range r.after {
+		Must(t, r.before[i] == info.Op)
+		Must(t, info == expects[i])
+	}
+}
+
+func TestInstrumentDepthOverflow(t *testing.T) {
+	r := &recorder{}
+	tree := New(WithInstrument(r))
+	// Keys sharing all the remainders of the first 9 primes.
+	step := uint32(2 * 3 * 5 * 7 * 11 * 13 * 17 * 19 * 23)
+	for i := uint32(0); i < 10; i++ {
+		tree.Put(Uint32(i * step))
+	}
+	Must(t, tree.Len() == 9)
+	info := r.after[len(r.after)-1]
+	Must(t, info.Op == OpPut && info.Key == 9*step && info.Depth == 9)
+}
+
+func TestOpString(t *testing.T) {
+	Must(t, OpGet.String() == "get")
+	Must(t, OpPut.String() == "put")
+	Must(t, OpDelete.String() == "delete")
+	Must(t, Op(-1).String() == "unknown")
+}
+
+// tickClock is a clock advancing by step on every read.
+type tickClock struct {
+	now  time.Time
+	step time.Duration
+}
+
+func (c *tickClock) Now() time.Time {
+	c.now = c.now.Add(c.step)
+	return c.now
+}
+
+func TestSlowOpThreshold(t *testing.T) {
+	clock := &tickClock{time.Unix(100, 0), time.Millisecond}
+	var slow []OpInfo
+	r := &recorder{}
+	tree := New(WithClock(clock), WithInstrument(r),
+		WithSlowOpThreshold(time.Millisecond, func(info OpInfo) {
+			slow = append(slow, info)
+		}))
+	tree.Put(Uint32(1))
+	Must(t, len(slow) == 0)
+	clock.step = 2 * time.Millisecond
+	tree.Put(Uint32(7))
+	tree.Get(Uint32(7))
+	Must(t, len(slow) == 2)
+	Must(t, slow[0].Op == OpPut && slow[0].Key == 7 && slow[0].Depth == 2)
+	Must(t, slow[1].Op == OpGet && slow[1].Duration == 2*time.Millisecond)
+	Must(t, len(r.after) == 3)
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+// Keyed is a typed htree storing values of T directly, the keys are derived
+// by a key function, so domain types don't need to implement Item.
+type Keyed[T any] struct {
+	t   *HTree
+	key func(T) uint32
+}
+
+// keyed is an item of Keyed, the key is computed once on put.
+type keyed[T any] struct {
+	key   uint32
+	value T
+}
+
+// Key returns the key of the value.
+func (i *keyed[T]) Key() uint32 { return i.key }
+
+// NewKeyed creates a typed htree deriving the keys of the values by keyFn,
+// the options apply to the underlying htree.
+func NewKeyed[T any](keyFn func(T) uint32, opts ...Option) *Keyed[T] {
+	return &Keyed[T]{t: New(opts...), key: keyFn}
+}
+
+// Len returns the number of values in the tree.
+func (k *Keyed[T]) Len() int { return k.t.Len() }
+
+// Get returns the value with the key, false if not found.
+func (k *Keyed[T]) Get(key uint32) (T, bool) {
+	if item := k.t.GetKey(key); item != nil {
+		return item.(*keyed[T]).value, true
+	}
+	var zero T
+	return zero, false
+}
+
+// Put puts the value and returns it, or the value already in the tree with
+// the same key. It returns false if the depth overflows, see HTree.Put.
+func (k *Keyed[T]) Put(v T) (T, bool) {
+	key := k.key(v)
+	item := k.t.PutPath(NewKeyPath(key), &keyed[T]{key, v})
+	if item == nil {
+		var zero T
+		return zero, false
+	}
+	return item.(*keyed[T]).value, true
+}
+
+// Delete deletes the value with the key and returns it, false if not found.
+func (k *Keyed[T]) Delete(key uint32) (T, bool) {
+	if item := k.t.DeletePath(NewKeyPath(key)); item != nil {
+		return item.(*keyed[T]).value, true
+	}
+	var zero T
+	return zero, false
+}
+
+// Walk calls f on each value in the iteration order, stops if f returns
+// false.
+func (k *Keyed[T]) Walk(f func(T) bool) {
+	k.t.Walk(func(item Item) bool { return f(item.(*keyed[T]).value) })
+}
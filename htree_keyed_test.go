@@ -0,0 +1,47 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import "testing"
+
+type user struct {
+	id   uint32
+	name string
+}
+
+func TestKeyed(t *testing.T) {
+	users := NewKeyed(func(u user) uint32 { return u.id })
+	v, ok := users.Put(user{1, "a"})
+	Must(t, ok && v == user{1, "a"})
+	// Existing kept.
+	v, ok = users.Put(user{1, "b"})
+	Must(t, ok && v == user{1, "a"})
+	users.Put(user{7, "c"})
+	Must(t, users.Len() == 2)
+	v, ok = users.Get(7)
+	Must(t, ok && v.name == "c")
+	_, ok = users.Get(3)
+	Must(t, !ok)
+	n := 0
+	users.Walk(func(u user) bool {
+		n++
+		return true
+	})
+	Must(t, n == 2)
+	v, ok = users.Delete(1)
+	Must(t, ok && v.name == "a")
+	_, ok = users.Delete(1)
+	Must(t, !ok)
+	Must(t, users.Len() == 1)
+}
+
+func TestKeyedOverflow(t *testing.T) {
+	values := NewKeyed(func(v uint32) uint32 { return v })
+	step := uint32(2 * 3 * 5 * 7 * 11 * 13 * 17 * 19 * 23)
+	for i := uint32(0); i < 9; i++ {
+		_, ok := values.Put(i * step)
+		Must(t, ok)
+	}
+	_, ok := values.Put(9 * step)
+	Must(t, !ok)
+}
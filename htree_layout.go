@@ -0,0 +1,17 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+//go:build !htree_cacheline
+// +build !htree_cacheline
+
+package htree
+
+// Number of children stored inline in a node, more children spill to a
+// separate array on the heap. Inlined children save an allocation and a
+// pointer hop for most of the inner nodes, but cost the leaves memory, 2
+// keeps the node in 48 bytes.
+//
+// Build with the tag htree_cacheline to size nodes to cache lines.
+const inlineChildren = 2
+
+// Size of a node in bytes, 48 on 64-bit platforms.
+const nodeSize = (3+inlineChildren)*ptrSize + 8
@@ -0,0 +1,174 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sync"
+)
+
+// ErrKeyOverflow is returned on loading a varint key larger than uint32.
+var ErrKeyOverflow = errors.New("htree: key overflows uint32")
+
+// Number of keys sent to a loading worker at once.
+const loadBatch = 4096
+
+// LoadOption configures LoadKeys.
+type LoadOption func(c *loadConfig)
+
+// loadConfig is the configuration of LoadKeys.
+type loadConfig struct {
+	fixed32  bool
+	parallel bool
+}
+
+// WithFixed32 reads the keys as 4 bytes little endian integers instead of
+// unsigned varints.
+func WithFixed32() LoadOption {
+	return func(c *loadConfig) { c.fixed32 = true }
+}
+
+// WithParallel inserts the keys of the two root branches, i.e. the even
+// and the odd keys, in two goroutines. The resulting tree is the same as
+// loaded sequentially. The tree clock must be safe for concurrent use in
+// the timestamps mode, and instruments are not called. It's ignored if the
+// changes are tracked or appended, or the tree has secondary indexes.
+func WithParallel() LoadOption {
+	return func(c *loadConfig) { c.parallel = true }
+}
+
+// LoadKeys reads a stream of unsigned varint keys till EOF and puts them
+// as Uint32 items, returns the number of items newly inserted. The reads
+// are buffered. On an error, the keys before it are kept.
+func (t *HTree) LoadKeys(r io.Reader, opts ...LoadOption) (int, error) {
+	if t.frozen {
+		panic(ErrFrozen)
+	}
+	c := &loadConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	br := bufio.NewReaderSize(r, 64<<10)
+	next := readUvarintKey
+	if c.fixed32 {
+		next = readFixed32Key
+	}
+	length := t.length
+	if c.parallel && t.changes == nil && t.appender == nil && t.secondaries == nil {
+		err := t.loadParallel(br, next)
+		return t.length - length, err
+	}
+	for {
+		key, err := next(br)
+		if err == io.EOF {
+			return t.length - length, nil
+		}
+		if err != nil {
+			return t.length - length, err
+		}
+		t.Put(Uint32(key))
+	}
+}
+
+// readUvarintKey reads an unsigned varint key.
+func readUvarintKey(br *bufio.Reader) (uint32, error) {
+	key, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, err
+	}
+	if key > math.MaxUint32 {
+		return 0, ErrKeyOverflow
+	}
+	return uint32(key), nil
+}
+
+// readFixed32Key reads a 4 bytes little endian key.
+func readFixed32Key(br *bufio.Reader) (uint32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(br, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b[:]), nil
+}
+
+// loadParallel loads the keys of each root branch into a worker tree
+// holding only the branch, and grafts the branches back at last. The
+// branches never interfere, so the workers don't synchronize.
+func (t *HTree) loadParallel(br *bufio.Reader, next func(*bufio.Reader) (uint32, error)) error {
+	var (
+		workers [2]*HTree
+		chans   [2]chan []uint32
+		batches [2][]uint32
+		wg      sync.WaitGroup
+	)
+	for r := range workers {
+		w := &HTree{
+			root:       &node{owner: t.owner},
+			clock:      t.clock,
+			timestamps: t.timestamps,
+			owner:      t.owner,
+		}
+		children := t.root.children()
+		if ok, i, _ := children.search(int8(r)); ok {
+			w.root.insertChild(0, children[i])
+		}
+		workers[r] = w
+		chans[r] = make(chan []uint32, 2)
+		batches[r] = make([]uint32, 0, loadBatch)
+		wg.Add(1)
+		go func(w *HTree, ch chan []uint32) {
+			defer wg.Done()
+			for batch := range ch {
+				for _, key := range batch {
+					w.Put(Uint32(key))
+				}
+			}
+		}(w, chans[r])
+	}
+	var err error
+	for {
+		var key uint32
+		if key, err = next(br); err != nil {
+			break
+		}
+		r := key % 2
+		batches[r] = append(batches[r], key)
+		if len(batches[r]) == loadBatch {
+			chans[r] <- batches[r]
+			batches[r] = make([]uint32, 0, loadBatch)
+		}
+	}
+	for r := range chans {
+		chans[r] <- batches[r]
+		close(chans[r])
+	}
+	wg.Wait()
+	// Graft the branches.
+	var s children
+	for _, w := range workers {
+		s = append(s, w.root.children()...)
+		t.length += w.length
+		t.duplicates += w.duplicates
+		t.generation += w.generation
+		for d := range t.levels {
+			t.inserts[d] += w.inserts[d]
+			t.levels[d] += w.levels[d]
+		}
+		if w.height > t.height {
+			t.height = w.height
+		}
+	}
+	t.root = t.mutable(t.root)
+	t.root.adopt(s)
+	if t.index != nil {
+		t.reindex()
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
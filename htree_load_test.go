@@ -0,0 +1,80 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestLoadKeys(t *testing.T) {
+	var varints, fixed []byte
+	keys := make([]uint32, 10000)
+	for i := range keys {
+		keys[i] = rand.Uint32() % 100000
+		varints = binary.AppendUvarint(varints, uint64(keys[i]))
+		fixed = binary.LittleEndian.AppendUint32(fixed, keys[i])
+	}
+	expect := New()
+	for _, key := range keys {
+		expect.Put(Uint32(key))
+	}
+	cases := []struct {
+		data []byte
+		opts []LoadOption
+	}{
+		{varints, nil},
+		{varints, []LoadOption{WithParallel()}},
+		{fixed, []LoadOption{WithFixed32()}},
+		{fixed, []LoadOption{WithFixed32(), WithParallel()}},
+	}
+	for _, c := range cases {
+		tree := New()
+		n, err := tree.LoadKeys(bytes.NewReader(c.data), c.opts...)
+		Must(t, err == nil)
+		Must(t, n == expect.Len())
+		Must(t, tree.Validate() == nil)
+		// Same as loaded sequentially.
+		Must(t, reflect.DeepEqual(tree.AppendTo(nil), expect.AppendTo(nil)))
+		Must(t, reflect.DeepEqual(tree.LevelCounts(), expect.LevelCounts()))
+		Must(t, tree.Duplicates() == expect.Duplicates())
+	}
+}
+
+func TestLoadKeysExisting(t *testing.T) {
+	var data []byte
+	for key := uint64(0); key < 1000; key++ {
+		data = binary.AppendUvarint(data, key)
+	}
+	for _, opts := range [][]LoadOption{nil, {WithParallel()}} {
+		tree := New()
+		for i := 0; i < 1500; i += 3 {
+			tree.Put(Uint32(i))
+		}
+		// Loading into a clone leaves the original untouched.
+		clone := tree.CloneCOW()
+		n, err := clone.LoadKeys(bytes.NewReader(data), opts...)
+		Must(t, err == nil)
+		Must(t, n == 1000-334)
+		Must(t, clone.Len() == 1166)
+		Must(t, tree.Len() == 500)
+		Must(t, clone.Validate() == nil)
+		Must(t, tree.Validate() == nil)
+	}
+}
+
+func TestLoadKeysError(t *testing.T) {
+	data := binary.AppendUvarint(nil, 1)
+	data = binary.AppendUvarint(data, 1<<32)
+	for _, opts := range [][]LoadOption{nil, {WithParallel()}} {
+		tree := New()
+		n, err := tree.LoadKeys(bytes.NewReader(data), opts...)
+		Must(t, n == 1 && err == ErrKeyOverflow)
+		n, err = tree.LoadKeys(bytes.NewReader([]byte{2, 0x80}), opts...)
+		Must(t, n == 1 && err == io.ErrUnexpectedEOF)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Map is a drop-in replacement of sync.Map keyed by uint32, backed by a
+// htree to save memory. Like sync.Map, it's safe for concurrent use,
+// optimized for read-mostly workloads, and the zero value is empty and
+// ready for use.
+//
+// Like RCU, writes are serialized, they modify a working Overflow and
+// publish a frozen CloneCOW of its tree, loads read the published tree
+// without locks. The keys the tree can't place are in the side map of the
+// Overflow, while there are any, loads missing the tree take a read lock to
+// look them up.
+type Map struct {
+	mu         sync.RWMutex
+	w          *Overflow    // working entries, guarded by mu
+	h          Holder       // published snapshot of the tree of w
+	overflowed atomic.Int64 // number of entries in the side map of w
+}
+
+// mapEntry is an item of Map, it's never modified once in the tree, but
+// replaced, since it's shared with the readers.
+type mapEntry struct {
+	key   uint32
+	value any
+}
+
+// Key returns the key of the entry.
+func (e *mapEntry) Key() uint32 { return e.key }
+
+// update calls f with the working entries under the lock, and publishes
+// them if f reports a change.
+func (m *Map) update(f func(o *Overflow) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.w == nil {
+		m.w = NewOverflow()
+	}
+	if !f(m.w) {
+		return
+	}
+	s := m.w.Tree().CloneCOW()
+	s.Freeze()
+	m.h.Store(s)
+	m.overflowed.Store(int64(m.w.Overflowed()))
+}
+
+// Load returns the value stored for the key, or nil if no value is
+// present. The ok result indicates whether value was found.
+func (m *Map) Load(key uint32) (value any, ok bool) {
+	if s := m.h.Load(); s != nil {
+		if item := s.GetKey(key); item != nil {
+			return item.(*mapEntry).value, true
+		}
+	}
+	if m.overflowed.Load() == 0 {
+		return nil, false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if item := m.w.Get(key); item != nil {
+		return item.(*mapEntry).value, true
+	}
+	return nil, false
+}
+
+// Store sets the value for the key.
+func (m *Map) Store(key uint32, value any) {
+	m.update(func(o *Overflow) bool {
+		o.Replace(&mapEntry{key, value})
+		return true
+	})
+}
+
+// LoadOrStore returns the existing value for the key if present, otherwise
+// it stores and returns the given value. The loaded result is true if the
+// value was loaded, false if stored.
+func (m *Map) LoadOrStore(key uint32, value any) (actual any, loaded bool) {
+	if actual, loaded = m.Load(key); loaded {
+		return
+	}
+	m.update(func(o *Overflow) bool {
+		if item := o.Get(key); item != nil {
+			actual, loaded = item.(*mapEntry).value, true
+			return false
+		}
+		actual = value
+		o.Put(&mapEntry{key, value})
+		return true
+	})
+	return
+}
+
+// LoadAndDelete deletes the value for the key, returning the previous value
+// if any. The loaded result reports whether the key was present.
+func (m *Map) LoadAndDelete(key uint32) (value any, loaded bool) {
+	if _, loaded = m.Load(key); !loaded {
+		return
+	}
+	m.update(func(o *Overflow) bool {
+		item := o.Delete(key)
+		if item == nil {
+			loaded = false
+			return false
+		}
+		value, loaded = item.(*mapEntry).value, true
+		return true
+	})
+	return
+}
+
+// Delete deletes the value for the key.
+func (m *Map) Delete(key uint32) {
+	m.LoadAndDelete(key)
+}
+
+// Range calls f sequentially for each key and value present in the map,
+// stops if f returns false. Unlike sync.Map, the keys in the tree are
+// ranged over a snapshot, the modifications meanwhile, including the ones
+// by f, don't affect the iteration.
+func (m *Map) Range(f func(key uint32, value any) bool) {
+	ok := true
+	if s := m.h.Load(); s != nil {
+		s.Walk(func(item Item) bool {
+			e := item.(*mapEntry)
+			ok = f(e.key, e.value)
+			return ok
+		})
+	}
+	if !ok || m.overflowed.Load() == 0 {
+		return
+	}
+	// Copy the side map, f may modify the map.
+	var entries []*mapEntry
+	m.mu.RLock()
+	m.w.WalkOverflowed(func(item Item) bool {
+		entries = append(entries, item.(*mapEntry))
+		return true
+	})
+	m.mu.RUnlock()
+	for _, e := range entries {
+		if !f(e.key, e.value) {
+			return
+		}
+	}
+}
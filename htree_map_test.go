@@ -0,0 +1,96 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	var m Map
+	_, ok := m.Load(1)
+	Must(t, !ok)
+	m.Store(1, "a")
+	m.Store(1, "b")
+	value, ok := m.Load(1)
+	Must(t, ok && value == "b")
+	actual, loaded := m.LoadOrStore(1, "c")
+	Must(t, loaded && actual == "b")
+	actual, loaded = m.LoadOrStore(2, "c")
+	Must(t, !loaded && actual == "c")
+	value, loaded = m.LoadAndDelete(1)
+	Must(t, loaded && value == "b")
+	_, loaded = m.LoadAndDelete(1)
+	Must(t, !loaded)
+	m.Delete(2)
+	_, ok = m.Load(2)
+	Must(t, !ok)
+}
+
+func TestMapOverflow(t *testing.T) {
+	var m Map
+	// Keys sharing all the remainders of the first 9 primes.
+	step := uint32(2 * 3 * 5 * 7 * 11 * 13 * 17 * 19 * 23)
+	for i := uint32(0); i < 12; i++ {
+		m.Store(i*step, i)
+	}
+	m.Store(11*step, "x")
+	value, ok := m.Load(11 * step)
+	Must(t, ok && value == "x")
+	seen := map[uint32]bool{}
+	m.Range(func(key uint32, value any) bool {
+		seen[key] = true
+		return true
+	})
+	Must(t, len(seen) == 12)
+	// Stops early.
+	n := 0
+	m.Range(func(key uint32, value any) bool {
+		n++
+		return n < 10
+	})
+	Must(t, n == 10)
+	value, loaded := m.LoadAndDelete(11 * step)
+	Must(t, loaded && value == "x")
+	_, ok = m.Load(11 * step)
+	Must(t, !ok)
+}
+
+func TestMapConcurrent(t *testing.T) {
+	// Keys of the multiples of step share all the remainders of the first 9
+	// primes, most of them overflow.
+	step := uint32(2 * 3 * 5 * 7 * 11 * 13 * 17 * 19 * 23)
+	for _, mul := range []uint32{1, step} {
+		var (
+			m  Map
+			wg sync.WaitGroup
+		)
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					key := uint32(i%50) * mul
+					switch i % 4 {
+					case 0:
+						m.Store(key, g)
+					case 1:
+						m.LoadOrStore(key, g)
+					case 2:
+						m.Load(key)
+					case 3:
+						m.Range(func(key uint32, value any) bool { return true })
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+		n := 0
+		m.Range(func(key uint32, value any) bool {
+			n++
+			return true
+		})
+		Must(t, n == 50)
+	}
+}
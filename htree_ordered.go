@@ -0,0 +1,235 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"math"
+	"sort"
+)
+
+// Max number of keys in a block of the ordered index.
+const indexBlock = 256
+
+// keyBlock is a block of sorted keys in the ordered index.
+type keyBlock struct {
+	keys  []uint32
+	owner uint32 // id of the tree owning the block
+}
+
+// keyIndex is the sorted keys of the tree in the ordered mode, split into
+// blocks, so that an insert or delete moves at most a block of keys. Like
+// the nodes, the index and its blocks are shared with the clones and copied
+// on the first modification, a write copies a single block.
+type keyIndex struct {
+	blocks []*keyBlock // ordered, none of them is empty
+	owner  uint32      // id of the tree owning the index
+}
+
+// WithOrderedIndex maintains the sorted keys alongside the tree, which
+// serves the ordered queries, e.g. Floor, Ceil and Range, in logarithmic
+// time, while the point lookups still go through the tree only. It costs
+// about 4 bytes per item and slows down inserts and deletes.
+func WithOrderedIndex() Option {
+	return func(t *HTree) { t.index = &keyIndex{} }
+}
+
+// Ordered reports whether the tree maintains the ordered index.
+func (t *HTree) Ordered() bool { return t.index != nil }
+
+// mutableIndex returns the index, or a copy of it if it's not owned.
+func (t *HTree) mutableIndex() *keyIndex {
+	if t.index.owner != t.owner {
+		blocks := make([]*keyBlock, len(t.index.blocks))
+		copy(blocks, t.index.blocks)
+		t.index = &keyIndex{blocks, t.owner}
+	}
+	return t.index
+}
+
+// mutableBlock returns the i-th block of the index, copies it if it's not
+// owned. The index must be owned already.
+func (t *HTree) mutableBlock(i int) *keyBlock {
+	b := t.index.blocks[i]
+	if b.owner != t.owner {
+		keys := make([]uint32, len(b.keys), len(b.keys)+1)
+		copy(keys, b.keys)
+		b = &keyBlock{keys, t.owner}
+		t.index.blocks[i] = b
+	}
+	return b
+}
+
+// block returns the index of the first block whose last key is not less
+// than key, len(blocks) if there is none.
+func (x *keyIndex) block(key uint32) int {
+	return sort.Search(len(x.blocks), func(i int) bool {
+		keys := x.blocks[i].keys
+		return keys[len(keys)-1] >= key
+	})
+}
+
+// seek returns the position of the first key not less than key, the block
+// index is len(blocks) if there is none.
+func (x *keyIndex) seek(key uint32) (int, int) {
+	i := x.block(key)
+	if i == len(x.blocks) {
+		return i, 0
+	}
+	keys := x.blocks[i].keys
+	return i, sort.Search(len(keys), func(j int) bool { return keys[j] >= key })
+}
+
+// indexInsert adds a new key to the index, splits the block if it's full.
+func (t *HTree) indexInsert(key uint32) {
+	x := t.mutableIndex()
+	if len(x.blocks) == 0 {
+		x.blocks = append(x.blocks, &keyBlock{[]uint32{key}, t.owner})
+		return
+	}
+	i, j := x.seek(key)
+	if i == len(x.blocks) {
+		// Greater than all, append to the last block.
+		i = len(x.blocks) - 1
+		j = len(x.blocks[i].keys)
+	}
+	b := t.mutableBlock(i)
+	b.keys = append(b.keys, 0)
+	copy(b.keys[j+1:], b.keys[j:])
+	b.keys[j] = key
+	if len(b.keys) > indexBlock {
+		half := len(b.keys) / 2
+		right := &keyBlock{make([]uint32, len(b.keys)-half, indexBlock), t.owner}
+		copy(right.keys, b.keys[half:])
+		b.keys = b.keys[:half]
+		x.blocks = append(x.blocks, nil)
+		copy(x.blocks[i+2:], x.blocks[i+1:])
+		x.blocks[i+1] = right
+	}
+}
+
+// indexDelete removes a key from the index, drops the block if it's empty.
+func (t *HTree) indexDelete(key uint32) {
+	x := t.mutableIndex()
+	i, j := x.seek(key)
+	if len(x.blocks[i].keys) == 1 {
+		x.blocks = append(x.blocks[:i], x.blocks[i+1:]...)
+		return
+	}
+	b := t.mutableBlock(i)
+	b.keys = append(b.keys[:j], b.keys[j+1:]...)
+}
+
+// reindex rebuilds the index from the tree.
+func (t *HTree) reindex() {
+	keys := make([]uint32, 0, t.length)
+	t.walk(t.root, func(item Item) bool {
+		keys = append(keys, item.Key())
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	x := &keyIndex{owner: t.owner}
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > indexBlock {
+			n = indexBlock
+		}
+		x.blocks = append(x.blocks, &keyBlock{keys[:n:n], t.owner})
+		keys = keys[n:]
+	}
+	t.index = x
+}
+
+// Floor returns the item with the greatest key less than or equal to the
+// key, nil if there is none. Without the ordered index, all items are
+// scanned.
+func (t *HTree) Floor(key uint32) Item {
+	if t.index == nil {
+		return t.scanBound(key, func(k, best uint32) bool { return k <= key && k >= best })
+	}
+	x := t.index
+	i, j := x.seek(key)
+	if i < len(x.blocks) && x.blocks[i].keys[j] == key {
+		return t.GetKey(key)
+	}
+	// Step back.
+	switch {
+	case j > 0:
+		return t.GetKey(x.blocks[i].keys[j-1])
+	case i > 0:
+		keys := x.blocks[i-1].keys
+		return t.GetKey(keys[len(keys)-1])
+	}
+	return nil
+}
+
+// Ceil returns the item with the smallest key greater than or equal to the
+// key, nil if there is none. Without the ordered index, all items are
+// scanned.
+func (t *HTree) Ceil(key uint32) Item {
+	if t.index == nil {
+		return t.scanBound(key, func(k, best uint32) bool { return k >= key && k <= best })
+	}
+	x := t.index
+	i, j := x.seek(key)
+	if i == len(x.blocks) {
+		return nil
+	}
+	return t.GetKey(x.blocks[i].keys[j])
+}
+
+// scanBound returns the exact match of the key if any, else scans for the
+// best item, better reports whether key k is better than the best one.
+func (t *HTree) scanBound(key uint32, better func(k, best uint32) bool) Item {
+	if item := t.GetKey(key); item != nil {
+		return item
+	}
+	var found Item
+	t.walk(t.root, func(item Item) bool {
+		k := item.Key()
+		if (found == nil && better(k, k)) || (found != nil && better(k, found.Key())) {
+			found = item
+		}
+		return true
+	})
+	return found
+}
+
+// Range calls f on each item with key in [lo, hi] in ascending key order,
+// stops if f returns false. The tree must not be modified by f. Without the
+// ordered index, the matched keys are collected and sorted first.
+func (t *HTree) Range(lo, hi uint32, f func(Item) bool) {
+	if lo > hi {
+		return
+	}
+	if t.index == nil {
+		var keys []uint32
+		t.walk(t.root, func(item Item) bool {
+			if k := item.Key(); k >= lo && k <= hi {
+				keys = append(keys, k)
+			}
+			return true
+		})
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		for _, key := range keys {
+			if !f(t.GetKey(key)) {
+				return
+			}
+		}
+		return
+	}
+	x := t.index
+	i, j := x.seek(lo)
+	for ; i < len(x.blocks); i, j = i+1, 0 {
+		for _, key := range x.blocks[i].keys[j:] {
+			if key > hi || !f(t.GetKey(key)) {
+				return
+			}
+		}
+	}
+}
+
+// Ascend calls f on each item in ascending key order, stops if f returns
+// false, see Range.
+func (t *HTree) Ascend(f func(Item) bool) {
+	t.Range(0, math.MaxUint32, f)
+}
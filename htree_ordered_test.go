@@ -0,0 +1,147 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestFloorCeil(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithOrderedIndex()}} {
+		tree := New(opts...)
+		Must(t, tree.Ordered() == (opts != nil))
+		Must(t, tree.Floor(1) == nil && tree.Ceil(1) == nil)
+		for _, key := range []uint32{10, 20, 40} {
+			tree.Put(Uint32(key))
+		}
+		Must(t, tree.Floor(9) == nil)
+		Must(t, tree.Floor(10) == Uint32(10))
+		Must(t, tree.Floor(39) == Uint32(20))
+		Must(t, tree.Floor(^uint32(0)) == Uint32(40))
+		Must(t, tree.Ceil(0) == Uint32(10))
+		Must(t, tree.Ceil(20) == Uint32(20))
+		Must(t, tree.Ceil(21) == Uint32(40))
+		Must(t, tree.Ceil(41) == nil)
+		Must(t, tree.Nearest(30) == Uint32(20))
+		Must(t, tree.Nearest(31) == Uint32(40))
+		Must(t, tree.Nearest(1) == Uint32(10))
+		tree.Delete(Uint32(20))
+		Must(t, tree.Floor(39) == Uint32(10))
+		Must(t, tree.Ceil(11) == Uint32(40))
+		Must(t, tree.Validate() == nil)
+	}
+}
+
+func TestOrderedIndexRandom(t *testing.T) {
+	tree := New(WithOrderedIndex())
+	model := map[uint32]bool{}
+	for i := 0; i < 10000; i++ {
+		key := uint32(rand.Intn(1 << 12))
+		if rand.Intn(3) == 0 {
+			tree.Delete(Uint32(key))
+			delete(model, key)
+		} else {
+			tree.Put(Uint32(key))
+			model[key] = true
+		}
+	}
+	Must(t, tree.Validate() == nil)
+	keys := make([]uint32, 0, len(model))
+	for key := range model {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for q := uint32(0); q < 1<<12; q += 7 {
+		i := sort.Search(len(keys), func(i int) bool { return keys[i] > q })
+		if i == 0 {
+			Must(t, tree.Floor(q) == nil)
+		} else {
+			Must(t, tree.Floor(q) == Uint32(keys[i-1]))
+		}
+	}
+}
+
+func TestOrderedIndexHighKeys(t *testing.T) {
+	tree := New(WithOrderedIndex())
+	for _, key := range []uint32{1, 1<<31 - 1, 1 << 31, 1<<32 - 1} {
+		tree.Put(Uint32(key))
+	}
+	Must(t, tree.Validate() == nil)
+}
+
+func TestOrderedIndexCloneCOW(t *testing.T) {
+	tree := New(WithOrderedIndex())
+	for i := 0; i < 1000; i++ {
+		tree.Put(Uint32(i * 2))
+	}
+	clone := tree.CloneCOW()
+	clone.Put(Uint32(1))
+	clone.Delete(Uint32(0))
+	tree.Put(Uint32(3))
+	Must(t, tree.Ceil(1) == Uint32(2))
+	Must(t, clone.Ceil(0) == Uint32(1))
+	Must(t, tree.Floor(0) == Uint32(0))
+	Must(t, clone.Floor(3) == Uint32(2))
+	Must(t, tree.Validate() == nil)
+	Must(t, clone.Validate() == nil)
+}
+
+func TestOrderedIndexLoadKeys(t *testing.T) {
+	tree := New(WithOrderedIndex())
+	tree.Put(Uint32(5))
+	data := []byte{1, 2, 3, 4}
+	n, err := tree.LoadKeys(bytes.NewReader(data), WithParallel())
+	Must(t, err == nil && n == 4)
+	Must(t, tree.Validate() == nil)
+	Must(t, tree.Floor(100) == Uint32(5))
+}
+
+func TestRange(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithOrderedIndex()}} {
+		tree := New(opts...)
+		for i := 0; i < 2000; i++ {
+			tree.Put(Uint32(rand.Intn(1 << 14)))
+		}
+		var keys []uint32
+		tree.Ascend(func(item Item) bool {
+			keys = append(keys, item.Key())
+			return true
+		})
+		Must(t, len(keys) == tree.Len())
+		Must(t, sort.SliceIsSorted(keys, func(i, j int) bool { return keys[i] < keys[j] }))
+		for _, r := range [][2]uint32{{0, 0}, {100, 5000}, {5000, 100}, {1 << 13, 1 << 20}} {
+			var got []uint32
+			tree.Range(r[0], r[1], func(item Item) bool {
+				got = append(got, item.Key())
+				return true
+			})
+			var expect []uint32
+			for _, key := range keys {
+				if key >= r[0] && key <= r[1] {
+					expect = append(expect, key)
+				}
+			}
+			Must(t, len(got) == len(expect))
+			for i := range got {
+				Must(t, got[i] == expect[i])
+			}
+		}
+		// Stops.
+		n := 0
+		tree.Ascend(func(item Item) bool {
+			n++
+			return n < 3
+		})
+		Must(t, n == 3)
+	}
+}
+
+func BenchmarkOrderedIndexPut(b *testing.B) {
+	tree := New(WithOrderedIndex())
+	for i := 0; i < b.N; i++ {
+		tree.Put(Uint32(rand.Uint32()))
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+// Overflow is a htree which never fails a put: the items the tree can't
+// place, i.e. whose keys share the remainders on every depth with the items
+// on their paths, are kept in a side map. Keys sharing the remainders of
+// the first primes, e.g. multiples of 2*3*5*7*11*13, overflow early, so the
+// map may hold many of them. It's not safe for concurrent use.
+type Overflow struct {
+	t *HTree
+	m map[uint32]Item // items the tree can't place
+}
+
+// NewOverflow creates an overflow tree, the options apply to the htree.
+func NewOverflow(opts ...Option) *Overflow {
+	return &Overflow{t: New(opts...)}
+}
+
+// Tree returns the htree, which holds the items but the overflowed ones. It
+// must not be modified directly.
+func (o *Overflow) Tree() *HTree { return o.t }
+
+// Len returns the number of items.
+func (o *Overflow) Len() int { return o.t.Len() + len(o.m) }
+
+// Overflowed returns the number of items in the side map.
+func (o *Overflow) Overflowed() int { return len(o.m) }
+
+// Get returns the item with the key, nil if not found.
+func (o *Overflow) Get(key uint32) Item {
+	if item := o.t.GetKey(key); item != nil {
+		return item
+	}
+	return o.m[key]
+}
+
+// Put puts the item and returns it, or the item already there with the
+// same key.
+func (o *Overflow) Put(item Item) Item {
+	key := item.Key()
+	if old, ok := o.m[key]; ok {
+		return old
+	}
+	if result := o.t.PutPath(NewKeyPath(key), item); result != nil {
+		return result
+	}
+	if o.m == nil {
+		o.m = map[uint32]Item{}
+	}
+	o.m[key] = item
+	return item
+}
+
+// Replace puts the item in place of the one with the same key, returns the
+// replaced item, nil if there is none.
+func (o *Overflow) Replace(item Item) Item {
+	key := item.Key()
+	if old, ok := o.m[key]; ok {
+		o.m[key] = item
+		return old
+	}
+	p := NewKeyPath(key)
+	if old := o.t.replacePath(&p, item); old != nil {
+		return old
+	}
+	o.Put(item)
+	return nil
+}
+
+// Delete deletes the item with the key and returns it, nil if not found.
+func (o *Overflow) Delete(key uint32) Item {
+	if item := o.t.DeletePath(NewKeyPath(key)); item != nil {
+		return item
+	}
+	item := o.m[key]
+	delete(o.m, key)
+	return item
+}
+
+// Walk calls f on each item, the ones in the htree in the iteration order
+// first, stops if f returns false.
+func (o *Overflow) Walk(f func(Item) bool) {
+	ok := true
+	o.t.Walk(func(item Item) bool {
+		ok = f(item)
+		return ok
+	})
+	if ok {
+		o.WalkOverflowed(f)
+	}
+}
+
+// WalkOverflowed calls f on each item in the side map, stops if f returns
+// false.
+func (o *Overflow) WalkOverflowed(f func(Item) bool) {
+	for _, item := range o.m {
+		if !f(item) {
+			return
+		}
+	}
+}
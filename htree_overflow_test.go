@@ -0,0 +1,45 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import "testing"
+
+func TestOverflow(t *testing.T) {
+	o := NewOverflow()
+	// Keys sharing all the remainders of the first 9 primes.
+	step := uint32(2 * 3 * 5 * 7 * 11 * 13 * 17 * 19 * 23)
+	for i := uint32(0); i < 12; i++ {
+		Must(t, o.Put(csvItem{i * step, "a"}) == csvItem{i * step, "a"})
+	}
+	Must(t, o.Len() == 12 && o.Overflowed() == 3 && o.Tree().Len() == 9)
+	// Existing ones.
+	Must(t, o.Put(csvItem{0, "b"}) == csvItem{0, "a"})
+	Must(t, o.Put(csvItem{11 * step, "b"}) == csvItem{11 * step, "a"})
+	for i := uint32(0); i < 12; i++ {
+		Must(t, o.Get(i*step) == csvItem{i * step, "a"})
+	}
+	Must(t, o.Get(1) == nil)
+	// Replaced in place, either in the tree or the map.
+	Must(t, o.Replace(csvItem{0, "c"}) == csvItem{0, "a"})
+	Must(t, o.Replace(csvItem{11 * step, "c"}) == csvItem{11 * step, "a"})
+	Must(t, o.Replace(csvItem{1, "c"}) == nil)
+	Must(t, o.Get(0) == csvItem{0, "c"} && o.Get(11*step) == csvItem{11 * step, "c"})
+	Must(t, o.Get(1) == csvItem{1, "c"} && o.Len() == 13)
+	n := 0
+	o.Walk(func(item Item) bool {
+		n++
+		return true
+	})
+	Must(t, n == 13)
+	n = 0
+	o.Walk(func(item Item) bool {
+		n++
+		return n < 10
+	})
+	Must(t, n == 10)
+	Must(t, o.Delete(11*step) == csvItem{11 * step, "c"})
+	Must(t, o.Delete(0) == csvItem{0, "c"})
+	Must(t, o.Delete(0) == nil)
+	Must(t, o.Len() == 11 && o.Overflowed() == 2)
+	Must(t, o.Tree().Validate() == nil)
+}
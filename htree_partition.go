@@ -0,0 +1,64 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+// DeletePartition deletes all items whose keys are congruent to remainder
+// modulo the prime at given depth (0 for prime 2, 1 for prime 3, ...), and
+// returns the number of items deleted. The items deeper than depth are in
+// whole subtrees, which are detached at once, only the few items above are
+// deleted one by one. It returns 0 if the depth or remainder is out of
+// range.
+func (t *HTree) DeletePartition(depth int8, remainder int8) int {
+	if t.frozen {
+		panic(ErrFrozen)
+	}
+	if depth < 0 || int(depth) >= len(primes) || remainder < 0 || int(remainder) >= primes[depth] {
+		return 0
+	}
+	length := t.length
+	var shallow []uint32
+	t.root = t.partition(t.root, 0, depth, remainder, &shallow)
+	for _, key := range shallow {
+		p := NewKeyPath(key)
+		t.deletePath(&p)
+	}
+	return length - t.length
+}
+
+// partition detaches the subtree of the partition under the nodes at the
+// depth d, and collects the keys of the partition above. The depth is of
+// node n, which is returned or its copy if it's not owned.
+func (t *HTree) partition(n *node, depth, d, r int8, shallow *[]uint32) *node {
+	children := n.children()
+	if depth == d {
+		ok, i, _ := children.search(r)
+		if !ok {
+			return n
+		}
+		child := children[i]
+		n = t.mutable(n)
+		n.deleteChild(i)
+		t.detach(child, depth+1)
+		return n
+	}
+	for i, child := range children {
+		if key := child.item.Key(); modulo(key, d) == r {
+			*shallow = append(*shallow, key)
+		}
+		if c := t.partition(child, depth+1, d, r, shallow); c != child {
+			n = t.mutable(n)
+			n.children()[i] = c
+		}
+	}
+	return n
+}
+
+// detach accounts the items of a detached subtree as removed, the depth is
+// of node n.
+func (t *HTree) detach(n *node, depth int8) {
+	t.removed(n.value())
+	t.leave(depth)
+	for _, child := range n.children() {
+		t.detach(child, depth+1)
+	}
+}
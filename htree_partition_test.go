@@ -0,0 +1,48 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestDeletePartition(t *testing.T) {
+	for depth := int8(0); depth < 4; depth++ {
+		for r := int8(0); int(r) < primes[depth]; r++ {
+			tree := New(WithOrderedIndex())
+			model := map[Uint32]bool{}
+			for i := 0; i < 5000; i++ {
+				key := Uint32(rand.Intn(1 << 16))
+				tree.Put(key)
+				model[key] = true
+			}
+			clone := tree.CloneCOW()
+			expect := 0
+			for key := range model {
+				if modulo(uint32(key), depth) == r {
+					delete(model, key)
+					expect++
+				}
+			}
+			n := tree.DeletePartition(depth, r)
+			Must(t, n == expect)
+			mustEqual(t, tree, model)
+			Must(t, tree.Validate() == nil)
+			// The clone is untouched.
+			Must(t, clone.Len() == tree.Len()+n)
+			Must(t, clone.Validate() == nil)
+		}
+	}
+}
+
+func TestDeletePartitionOutOfRange(t *testing.T) {
+	tree := New()
+	tree.Put(Uint32(1))
+	Must(t, tree.DeletePartition(-1, 0) == 0)
+	Must(t, tree.DeletePartition(10, 0) == 0)
+	Must(t, tree.DeletePartition(0, 2) == 0)
+	Must(t, tree.DeletePartition(0, 0) == 0)
+	Must(t, tree.DeletePartition(0, 1) == 1)
+	Must(t, tree.Len() == 0)
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import "sync/atomic"
+
+// probes is the histograms of the depths the operations terminated at,
+// updated atomically so that concurrent readers of a frozen tree can
+// record.
+type probes struct {
+	gets [len(primes) + 1]uint64
+	puts [len(primes) + 1]uint64
+}
+
+// ProbeStats is the histograms of the depths the gets and puts terminated
+// at, i.e. the number of levels visited, the i-th element is the number of
+// operations terminated at depth i. A found key terminates at its depth,
+// a missing key at the depth the search stopped at, and a new insert at
+// the depth it landed. The deep tails reveal poorly hashing keys.
+type ProbeStats struct {
+	Gets []uint64
+	Puts []uint64
+}
+
+// WithProbeStats records the probe depths of the Get and Put operations
+// (including the key and path variants), queryable via Stats. It walks the
+// key path once more per operation. The clones by CloneCOW share the
+// histograms with the original.
+func WithProbeStats() Option {
+	return func(t *HTree) { t.probes = &probes{} }
+}
+
+// Stats returns the probe depth histograms, empty ones if WithProbeStats
+// is not enabled.
+func (t *HTree) Stats() ProbeStats {
+	s := ProbeStats{
+		Gets: make([]uint64, len(primes)+1),
+		Puts: make([]uint64, len(primes)+1),
+	}
+	if t.probes != nil {
+		for d := range s.Gets {
+			s.Gets[d] = atomic.LoadUint64(&t.probes.gets[d])
+			s.Puts[d] = atomic.LoadUint64(&t.probes.puts[d])
+		}
+	}
+	return s
+}
+
+// probe records the probe depth of an operation on the key path.
+func (t *HTree) probe(op Op, p *KeyPath) {
+	h := &t.probes.gets
+	if op == OpPut {
+		h = &t.probes.puts
+	}
+	atomic.AddUint64(&h[t.reach(p)], 1)
+}
+
+// reset zeros the histograms.
+func (s *probes) reset() {
+	for d := range s.gets {
+		atomic.StoreUint64(&s.gets[d], 0)
+		atomic.StoreUint64(&s.puts[d], 0)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import "testing"
+
+func TestProbeStats(t *testing.T) {
+	tree := New(WithProbeStats())
+	// Same as TestPutStats, 8 and 9 are at depth 3.
+	for i := 0; i < 10; i++ {
+		tree.Put(Uint32(i))
+	}
+	tree.Put(Uint32(8))
+	Must(t, tree.Get(Uint32(8)) == Uint32(8))
+	// 10%2=0 reaches 0, 10%3=1 reaches 4, and stops.
+	Must(t, tree.GetKey(10) == nil)
+	tree.Delete(Uint32(9))
+	s := tree.Stats()
+	Must(t, len(s.Gets) == 11 && len(s.Puts) == 11)
+	Must(t, s.Puts[1] == 2 && s.Puts[2] == 6 && s.Puts[3] == 3)
+	Must(t, s.Gets[2] == 1 && s.Gets[3] == 1)
+	// Shared by the clones.
+	c := tree.CloneCOW()
+	c.Get(Uint32(0))
+	Must(t, tree.Stats().Gets[1] == 1)
+	tree.ResetStats()
+	s = tree.Stats()
+	Must(t, s.Gets[1] == 0 && s.Puts[2] == 0)
+}
+
+func TestProbeStatsDisabled(t *testing.T) {
+	tree := New()
+	tree.Put(Uint32(1))
+	tree.Get(Uint32(1))
+	s := tree.Stats()
+	Must(t, len(s.Gets) == 11 && s.Gets[1] == 0 && s.Puts[1] == 0)
+}
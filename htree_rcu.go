@@ -0,0 +1,77 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import "sync"
+
+// RCU is a read-copy-update wrapper of htree for read-mostly workloads,
+// safe for concurrent use. Readers don't synchronize but an atomic load of
+// the published snapshot. Writers are serialized, they modify a private
+// working tree and publish a frozen CloneCOW of it, so each write copies
+// only the nodes on its path instead of the whole tree.
+//
+// Old snapshots are reclaimed by the garbage collector once the last reader
+// drops them, which plays the grace period of the classic RCU. Instruments
+// of the tree are called by the readers concurrently, they must be safe for
+// concurrent use.
+type RCU struct {
+	h  Holder
+	mu sync.Mutex // serializes writers
+	w  *HTree     // working tree, guarded by mu
+}
+
+// NewRCU creates a RCU wrapper around the tree, which shouldn't be used by
+// the caller anymore.
+func NewRCU(t *HTree) *RCU {
+	r := &RCU{w: t}
+	r.publish()
+	return r
+}
+
+// publish stores a frozen snapshot of the working tree.
+func (r *RCU) publish() {
+	s := r.w.CloneCOW()
+	s.Freeze()
+	r.h.Store(s)
+}
+
+// Load returns the current snapshot, which is frozen, callers doing many
+// reads can hold it for a consistent view.
+func (r *RCU) Load() *HTree { return r.h.Load() }
+
+// Get gets the item from the current snapshot, nil if not found.
+func (r *RCU) Get(item Item) Item { return r.h.Load().Get(item) }
+
+// GetKey gets the item with the key from the current snapshot.
+func (r *RCU) GetKey(key uint32) Item { return r.h.Load().GetKey(key) }
+
+// Len returns the number of items in the current snapshot.
+func (r *RCU) Len() int { return r.h.Load().Len() }
+
+// Put puts the item and publishes the change, see HTree.Put.
+func (r *RCU) Put(item Item) Item {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := r.w.Put(item)
+	r.publish()
+	return result
+}
+
+// Delete deletes the item and publishes the change, see HTree.Delete.
+func (r *RCU) Delete(item Item) Item {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := r.w.Delete(item)
+	r.publish()
+	return result
+}
+
+// Update calls f with the working tree and publishes the changes at once,
+// readers see either none or all of them. The tree must not be retained
+// after f returns.
+func (r *RCU) Update(f func(t *HTree)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f(r.w)
+	r.publish()
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRCU(t *testing.T) {
+	r := NewRCU(New())
+	Must(t, r.Len() == 0)
+	Must(t, r.Put(Uint32(1)) == Uint32(1))
+	snapshot := r.Load()
+	Must(t, snapshot.Frozen())
+	r.Update(func(t *HTree) {
+		t.Put(Uint32(2))
+		t.Put(Uint32(3))
+		t.Delete(Uint32(1))
+	})
+	Must(t, r.Get(Uint32(1)) == nil)
+	Must(t, r.GetKey(3) == Uint32(3))
+	Must(t, r.Delete(Uint32(2)) == Uint32(2))
+	Must(t, r.Len() == 1)
+	// The old snapshot is untouched.
+	Must(t, snapshot.Len() == 1)
+	Must(t, snapshot.Get(Uint32(1)) == Uint32(1))
+	Must(t, snapshot.Validate() == nil)
+	Must(t, r.Load().Validate() == nil)
+}
+
+func TestRCUConcurrent(t *testing.T) {
+	r := NewRCU(New())
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				r.Put(Uint32(g*1000 + i))
+				if i%2 == 1 {
+					r.Delete(Uint32(g*1000 + i))
+				}
+			}
+		}(g)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				s := r.Load()
+				// Snapshots are consistent.
+				if s.Len() != s.Count(func(Item) bool { return true }) {
+					t.Error("inconsistent snapshot")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	Must(t, r.Len() == 400)
+	Must(t, r.Load().Validate() == nil)
+}
@@ -0,0 +1,135 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// ErrCorrupt is returned on reading malformed records.
+var ErrCorrupt = errors.New("htree: corrupt record")
+
+// Ops of the change records.
+const (
+	recordEnd    byte = iota // end of the records
+	recordPut                // an item is put
+	recordDelete             // an item is deleted
+	recordSync               // a sync marker in the change logs
+)
+
+// Max payload size of a record, larger sizes are taken as corruption.
+const maxPayload = 64 << 20
+
+// appendRecord encodes a change record: the op, the key as an uvarint, and
+// for puts the length prefixed payload.
+func appendRecord(b []byte, op byte, key uint32, payload []byte) []byte {
+	b = append(b, op)
+	if op == recordEnd {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(key))
+	if op == recordPut {
+		b = binary.AppendUvarint(b, uint64(len(payload)))
+		b = append(b, payload...)
+	}
+	return b
+}
+
+// readRecord decodes a change record, the payload is read into buf if it
+// fits. It returns io.EOF only if there are no more bytes at all.
+func readRecord(br *bufio.Reader, buf []byte) (op byte, key uint32, payload []byte, err error) {
+	if op, err = br.ReadByte(); err != nil {
+		return
+	}
+	switch op {
+	case recordEnd:
+		return
+	case recordPut, recordDelete:
+	default:
+		return op, 0, nil, ErrCorrupt
+	}
+	k, err := binary.ReadUvarint(br)
+	if err != nil {
+		return op, 0, nil, noEOF(err)
+	}
+	if k > math.MaxUint32 {
+		return op, 0, nil, ErrCorrupt
+	}
+	key = uint32(k)
+	if op == recordDelete {
+		return
+	}
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return op, key, nil, noEOF(err)
+	}
+	if size > maxPayload {
+		return op, key, nil, ErrCorrupt
+	}
+	if uint64(cap(buf)) < size {
+		buf = make([]byte, size)
+	}
+	payload = buf[:size]
+	if _, err = io.ReadFull(br, payload); err != nil {
+		return op, key, nil, noEOF(err)
+	}
+	return
+}
+
+// noEOF converts io.EOF in the middle of a record to io.ErrUnexpectedEOF.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// decodeRecord decodes a put or delete record from b, the payload refers
+// to b.
+func decodeRecord(b []byte) (op byte, key uint32, payload []byte, err error) {
+	if len(b) == 0 || (b[0] != recordPut && b[0] != recordDelete) {
+		return 0, 0, nil, ErrCorrupt
+	}
+	op = b[0]
+	k, n := binary.Uvarint(b[1:])
+	if n <= 0 || k > math.MaxUint32 {
+		return 0, 0, nil, ErrCorrupt
+	}
+	key, b = uint32(k), b[1+n:]
+	if op == recordDelete {
+		if len(b) != 0 {
+			return 0, 0, nil, ErrCorrupt
+		}
+		return
+	}
+	size, n := binary.Uvarint(b)
+	if n <= 0 || size != uint64(len(b)-n) {
+		return 0, 0, nil, ErrCorrupt
+	}
+	return op, key, b[n:], nil
+}
+
+// applyRecord applies a put or delete record to the tree, a put replaces
+// the existing item in place. An item decoded with another key is corrupt.
+func (t *HTree) applyRecord(op byte, key uint32, payload []byte, dec func(uint32, []byte) (Item, error)) error {
+	p := NewKeyPath(key)
+	if op == recordDelete {
+		t.DeletePath(p)
+		return nil
+	}
+	item, err := dec(key, payload)
+	if err != nil {
+		return err
+	}
+	if item == nil || item.Key() != key {
+		return ErrCorrupt
+	}
+	if t.replacePath(&p, item) == nil && t.PutPath(p, item) == nil {
+		return ErrDepthOverflow
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+// bucket is the items sharing a secondary key. Like the nodes, it's
+// modified in place only by the index tree owning it, and replaced by a
+// copy if it's shared with the clones.
+type bucket struct {
+	key   uint32
+	items []Item
+	owner uint32 // id of the index tree owning the bucket
+}
+
+// Key returns the secondary key.
+func (b *bucket) Key() uint32 { return b.key }
+
+// secondary is a secondary index of the tree.
+type secondary struct {
+	fn   func(Item) uint32 // secondary key extractor
+	tree *HTree            // buckets by the secondary key
+}
+
+// secondaryIndexes is the secondary indexes of the tree by name. Like the
+// ordered index, it's shared with the clones and copied on the first
+// modification, the index trees are cloned by CloneCOW then.
+type secondaryIndexes struct {
+	byName map[string]*secondary
+	owner  uint32 // id of the tree owning the indexes
+}
+
+// AddIndex adds a secondary index by the key extractor fn, which is
+// maintained on the inserts and deletes of the tree and serves GetByIndex.
+// The existing items are indexed at once, an index of the same name is
+// replaced. The secondary key of an item must not change while it's in the
+// tree. Items whose secondary keys overflow the depth of the index tree,
+// i.e. collide with 9 other secondary keys on every remainder, are not
+// indexed.
+func (t *HTree) AddIndex(name string, fn func(Item) uint32) {
+	if t.frozen {
+		panic(ErrFrozen)
+	}
+	s := &secondary{fn: fn, tree: New()}
+	t.Walk(func(item Item) bool {
+		s.insert(item)
+		return true
+	})
+	t.mutableSecondaries().byName[name] = s
+}
+
+// GetByIndex returns the items whose secondary keys by the named index are
+// key, in the order of insertion, nil if there is none or no such index.
+// The returned slice is shared with the index, it must not be modified, and
+// is valid till the next modification of the tree.
+func (t *HTree) GetByIndex(name string, key uint32) []Item {
+	if t.secondaries == nil {
+		return nil
+	}
+	s, ok := t.secondaries.byName[name]
+	if !ok {
+		return nil
+	}
+	if b := s.tree.GetKey(key); b != nil {
+		return b.(*bucket).items
+	}
+	return nil
+}
+
+// mutableSecondaries returns the secondary indexes, or a copy of them if
+// they're not owned, it creates them if there is none.
+func (t *HTree) mutableSecondaries() *secondaryIndexes {
+	if t.secondaries == nil {
+		t.secondaries = &secondaryIndexes{map[string]*secondary{}, t.owner}
+	}
+	if t.secondaries.owner != t.owner {
+		byName := make(map[string]*secondary, len(t.secondaries.byName))
+		for name, s := range t.secondaries.byName {
+			byName[name] = &secondary{s.fn, s.tree.CloneCOW()}
+		}
+		t.secondaries = &secondaryIndexes{byName, t.owner}
+	}
+	return t.secondaries
+}
+
+// secondaryInsert indexes an item newly inserted.
+func (t *HTree) secondaryInsert(item Item) {
+	for _, s := range t.mutableSecondaries().byName {
+		s.insert(item)
+	}
+}
+
+// secondaryDelete unindexes an item removed.
+func (t *HTree) secondaryDelete(item Item) {
+	for _, s := range t.mutableSecondaries().byName {
+		s.delete(item)
+	}
+}
+
+// insert appends the item to the bucket of its secondary key.
+func (s *secondary) insert(item Item) {
+	key := s.fn(item)
+	b, _ := s.tree.GetKey(key).(*bucket)
+	switch {
+	case b == nil:
+		s.tree.Put(&bucket{key, []Item{item}, s.tree.owner})
+	case b.owner == s.tree.owner:
+		b.items = append(b.items, item)
+	default:
+		items := make([]Item, len(b.items), len(b.items)+1)
+		copy(items, b.items)
+		s.replace(&bucket{key, append(items, item), s.tree.owner})
+	}
+}
+
+// delete removes the item of the same key from the bucket of its secondary
+// key, and the bucket if it's empty then.
+func (s *secondary) delete(item Item) {
+	b, _ := s.tree.GetKey(s.fn(item)).(*bucket)
+	if b == nil {
+		return
+	}
+	for i, x := range b.items {
+		if x.Key() != item.Key() {
+			continue
+		}
+		switch {
+		case len(b.items) == 1:
+			s.tree.Delete(b)
+		case b.owner == s.tree.owner:
+			copy(b.items[i:], b.items[i+1:])
+			b.items[len(b.items)-1] = nil
+			b.items = b.items[:len(b.items)-1]
+		default:
+			items := make([]Item, 0, len(b.items)-1)
+			items = append(append(items, b.items[:i]...), b.items[i+1:]...)
+			s.replace(&bucket{b.key, items, s.tree.owner})
+		}
+		return
+	}
+}
+
+// replace replaces the bucket with the same key in place.
+func (s *secondary) replace(b *bucket) {
+	p := NewKeyPath(b.key)
+	s.tree.replacePath(&p, b)
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// tens is the secondary key extractor by the tens of the key.
+func tens(item Item) uint32 { return item.Key() / 10 }
+
+func TestSecondaryIndex(t *testing.T) {
+	tree := New()
+	tree.Put(Uint32(11))
+	tree.AddIndex("tens", tens)
+	tree.Put(Uint32(12))
+	tree.Put(Uint32(25))
+	items := tree.GetByIndex("tens", 1)
+	Must(t, len(items) == 2 && items[0] == Uint32(11) && items[1] == Uint32(12))
+	Must(t, len(tree.GetByIndex("tens", 2)) == 1)
+	Must(t, tree.GetByIndex("tens", 3) == nil)
+	Must(t, tree.GetByIndex("unknown", 1) == nil)
+	tree.Delete(Uint32(11))
+	items = tree.GetByIndex("tens", 1)
+	Must(t, len(items) == 1 && items[0] == Uint32(12))
+	tree.Delete(Uint32(25))
+	Must(t, tree.GetByIndex("tens", 2) == nil)
+	Must(t, tree.Validate() == nil)
+}
+
+func TestSecondaryIndexRandom(t *testing.T) {
+	tree := New()
+	tree.AddIndex("tens", tens)
+	model := map[uint32]bool{}
+	for i := 0; i < 10000; i++ {
+		key := uint32(rand.Intn(1 << 12))
+		if rand.Intn(3) == 0 {
+			tree.Delete(Uint32(key))
+			delete(model, key)
+		} else {
+			tree.Put(Uint32(key))
+			model[key] = true
+		}
+	}
+	for key := range model {
+		found := false
+		for _, item := range tree.GetByIndex("tens", key/10) {
+			found = found || item.Key() == key
+		}
+		Must(t, found)
+	}
+	Must(t, tree.Validate() == nil)
+}
+
+func TestSecondaryIndexCloneCOW(t *testing.T) {
+	tree := New()
+	tree.AddIndex("tens", tens)
+	for i := 0; i < 100; i++ {
+		tree.Put(Uint32(i))
+	}
+	c := tree.CloneCOW()
+	tree.Delete(Uint32(11))
+	c.Put(Uint32(100))
+	Must(t, len(tree.GetByIndex("tens", 1)) == 9)
+	Must(t, len(c.GetByIndex("tens", 1)) == 10)
+	Must(t, tree.GetByIndex("tens", 10) == nil)
+	Must(t, len(c.GetByIndex("tens", 10)) == 1)
+	Must(t, tree.Validate() == nil)
+	Must(t, c.Validate() == nil)
+	for _, part := range tree.Split(3) {
+		Must(t, part.Validate() == nil)
+	}
+}
+
+func TestSecondaryIndexInPlace(t *testing.T) {
+	tree := New()
+	tree.AddIndex("all", func(Item) uint32 { return 0 })
+	tree.Put(Uint32(0))
+	bucketOf := func(tree *HTree) Item {
+		return tree.secondaries.byName["all"].tree.GetKey(0)
+	}
+	b := bucketOf(tree)
+	for i := 1; i < 1000; i++ {
+		tree.Put(Uint32(i))
+	}
+	// Appended in place.
+	Must(t, bucketOf(tree) == b && len(tree.GetByIndex("all", 0)) == 1000)
+	// Copied once shared.
+	c := tree.CloneCOW()
+	items := tree.GetByIndex("all", 0)
+	c.Delete(Uint32(0))
+	Must(t, bucketOf(c) != b && len(c.GetByIndex("all", 0)) == 999)
+	Must(t, items[0] == Uint32(0) && len(tree.GetByIndex("all", 0)) == 1000)
+	tree.Put(Uint32(1000))
+	Must(t, bucketOf(tree) != b && len(tree.GetByIndex("all", 0)) == 1001)
+	Must(t, len(c.GetByIndex("all", 0)) == 999)
+	Must(t, tree.Validate() == nil && c.Validate() == nil)
+}
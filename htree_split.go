@@ -0,0 +1,91 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+// Split partitions the items into n trees by the residue paths of the keys,
+// e.g. the keys of the first of 2 trees are even, the original tree is
+// untouched. The trees share the nodes with the original by copy-on-write,
+// subtrees entirely in a partition are kept in place, and the others are
+// detached, so no item is re-hashed or copied but the few ones above the
+// partitioned depth. The trees don't modify shared nodes, they can be used
+// in different goroutines unless in the timestamps mode.
+func (t *HTree) Split(n int) []*HTree {
+	if n <= 1 {
+		return []*HTree{t.CloneCOW()}
+	}
+	// Partition by the remainders of the first depths, classes are the
+	// mixed radix numbers of the remainders, and are evenly assigned to the
+	// trees in order, so the classes with a common prefix are contiguous.
+	s := &splitter{n: n, classes: 1}
+	for s.classes < n && s.depth < int8(len(primes)) {
+		s.classes *= primes[s.depth]
+		s.depth++
+	}
+	trees := make([]*HTree, n)
+	for g := range trees {
+		c := t.CloneCOW()
+		var shallow []uint32
+		c.root = s.prune(c, c.root, 0, 0, g, &shallow)
+		for _, key := range shallow {
+			p := NewKeyPath(key)
+			c.deletePath(&p)
+		}
+		trees[g] = c
+	}
+	return trees
+}
+
+// splitter partitions a tree by the residue paths.
+type splitter struct {
+	n       int  // number of trees
+	depth   int8 // number of remainders in the paths
+	classes int  // number of residue paths
+}
+
+// group returns the tree of a residue path class.
+func (s *splitter) group(class int) int { return class * s.n / s.classes }
+
+// class returns the residue path class of a key.
+func (s *splitter) class(key uint32) int {
+	c := 0
+	for d := int8(0); d < s.depth; d++ {
+		c = c*primes[d] + int(modulo(key, d))
+	}
+	return c
+}
+
+// prune detaches the subtrees of n not in the group g from the tree t,
+// and collects the keys not in g above the partitioned depth. The depth is
+// of node n, and the prefix is the class prefix of its path. It returns n
+// or its copy if it's not owned.
+func (s *splitter) prune(t *HTree, n *node, depth int8, prefix int, g int, shallow *[]uint32) *node {
+	// Number of classes sharing a prefix of the children.
+	span := s.classes
+	for d := int8(0); d <= depth; d++ {
+		span /= primes[d]
+	}
+	children := n.children()
+	for i := len(children) - 1; i >= 0; i-- {
+		child := children[i]
+		lo := (prefix*primes[depth] + int(child.remainder)) * span
+		first, last := s.group(lo), s.group(lo+span-1)
+		switch {
+		case first == g && last == g:
+			// Entirely in the group.
+		case last < g || first > g:
+			// Entirely out of the group.
+			n = t.mutable(n)
+			n.deleteChild(i)
+			t.detach(child, depth+1)
+		default:
+			if key := child.item.Key(); s.group(s.class(key)) != g {
+				*shallow = append(*shallow, key)
+			}
+			if c := s.prune(t, child, depth+1, lo/span, g, shallow); c != child {
+				n = t.mutable(n)
+				n.children()[i] = c
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tree := New()
+	for i := 0; i < 10000; i++ {
+		tree.Put(Uint32(rand.Uint32()))
+	}
+	// Duplicates and overflows are not inserted.
+	length := tree.Len()
+	for _, n := range []int{1, 2, 3, 6, 7, 100} {
+		trees := tree.Split(n)
+		Must(t, len(trees) == n)
+		seen := map[uint32]int{}
+		total := 0
+		for g, part := range trees {
+			Must(t, part.Validate() == nil)
+			total += part.Len()
+			part.Walk(func(item Item) bool {
+				seen[item.Key()] = g
+				return true
+			})
+		}
+		// A partition of the items.
+		Must(t, total == tree.Len())
+		Must(t, len(seen) == tree.Len())
+		if n == 2 {
+			for key, g := range seen {
+				Must(t, int(key%2) == g)
+			}
+		}
+		Must(t, tree.Validate() == nil)
+		Must(t, tree.Len() == length)
+	}
+}
+
+func TestSplitIndependent(t *testing.T) {
+	tree := New()
+	for i := 0; i < 1000; i++ {
+		tree.Put(Uint32(i))
+	}
+	trees := tree.Split(3)
+	trees[0].Put(Uint32(5000))
+	trees[1].Delete(trees[1].Any())
+	for _, part := range trees {
+		Must(t, part.Validate() == nil)
+	}
+	Must(t, tree.Len() == 1000)
+	Must(t, tree.Get(Uint32(5000)) == nil)
+	Must(t, tree.Validate() == nil)
+}
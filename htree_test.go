@@ -3,9 +3,13 @@
 package htree
 
 import (
+	"context"
+	"math"
 	"math/rand"
 	"runtime"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 // Must asserts the given value is True for testing.
@@ -16,6 +20,11 @@ func Must(t *testing.T, v bool) {
 	}
 }
 
+// fakeClock is a manually advanced clock for testing.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
 func TestPrimesLargerThanUint32(t *testing.T) {
 	s := uint64(1)
 	for i := 0; i < len(primes); i++ {
@@ -38,14 +47,14 @@ func TestTreeInside(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		tree.Put(Uint32(i))
 	}
-	n1_0 := tree.root.children[0]
-	n1_1 := tree.root.children[1]
-	n2_0_0 := n1_0.children[0]
-	n2_0_1 := n1_0.children[1]
-	n2_0_2 := n1_0.children[2]
-	n2_1_0 := n1_1.children[0]
-	n2_1_1 := n1_1.children[1]
-	n2_1_2 := n1_1.children[2]
+	n1_0 := tree.root.children()[0]
+	n1_1 := tree.root.children()[1]
+	n2_0_0 := n1_0.children()[0]
+	n2_0_1 := n1_0.children()[1]
+	n2_0_2 := n1_0.children()[2]
+	n2_1_0 := n1_1.children()[0]
+	n2_1_1 := n1_1.children()[1]
+	n2_1_2 := n1_1.children()[2]
 	Must(t, n1_0.item == Uint32(0))
 	Must(t, n1_1.item == Uint32(1))
 	Must(t, n2_0_0.item == Uint32(6))
@@ -54,10 +63,10 @@ func TestTreeInside(t *testing.T) {
 	Must(t, n2_1_0.item == Uint32(3))
 	Must(t, n2_1_1.item == Uint32(7))
 	Must(t, n2_1_2.item == Uint32(5))
-	Must(t, len(n2_0_2.children) == 1)
-	Must(t, n2_0_2.children[0].item == Uint32(8))
-	Must(t, len(n2_1_0.children) == 1)
-	Must(t, n2_1_0.children[0].item == Uint32(9))
+	Must(t, len(n2_0_2.children()) == 1)
+	Must(t, n2_0_2.children()[0].item == Uint32(8))
+	Must(t, len(n2_1_0.children()) == 1)
+	Must(t, n2_1_0.children()[0].item == Uint32(9))
 	Must(t, n1_0.remainder == 0)
 	Must(t, n1_1.remainder == 1)
 	Must(t, n2_0_0.remainder == 0)
@@ -68,6 +77,40 @@ func TestTreeInside(t *testing.T) {
 	Must(t, n2_1_2.remainder == 2)
 }
 
+func TestNodeSize(t *testing.T) {
+	Must(t, unsafe.Sizeof(node{}) == nodeSize)
+}
+
+func TestNodeChildren(t *testing.T) {
+	n := &node{}
+	var ref []*node
+	for _, r := range rand.Perm(29) {
+		child := &node{remainder: int8(r)}
+		i := 0
+		for i < len(ref) && ref[i].remainder < child.remainder {
+			i++
+		}
+		ref = append(ref[:i], append([]*node{child}, ref[i:]...)...)
+		n.insertChild(i, child)
+		Must(t, len(n.children()) == len(ref))
+		for j, c := range n.children() {
+			Must(t, c == ref[j])
+		}
+	}
+	Must(t, n.spill != nil)
+	for len(ref) > 0 {
+		i := rand.Intn(len(ref))
+		ref = append(ref[:i], ref[i+1:]...)
+		n.deleteChild(i)
+		Must(t, len(n.children()) == len(ref))
+		for j, c := range n.children() {
+			Must(t, c == ref[j])
+		}
+	}
+	// Back to inline.
+	Must(t, n.spill == nil)
+}
+
 func TestPutN(t *testing.T) {
 	tree := New()
 	n := 1024
@@ -124,6 +167,146 @@ func TestPutNewNode(t *testing.T) {
 	Must(t, tree.Len() == 11)
 }
 
+func TestPutStats(t *testing.T) {
+	/*
+	       root
+	     /     \
+	    0       1     %2
+	   /|\     /|\
+	  6 4 2   3 7 5   %3
+	      |   |
+	      8   9       %5
+	*/
+	tree := New()
+	for i := 0; i < 10; i++ {
+		tree.Put(Uint32(i))
+	}
+	tree.Put(Uint32(8))
+	tree.Put(Uint32(0))
+	Must(t, tree.Duplicates() == 2)
+	depths := tree.InsertDepths()
+	Must(t, len(depths) == 10)
+	Must(t, depths[0] == 2)
+	Must(t, depths[1] == 6)
+	Must(t, depths[2] == 2)
+	Must(t, tree.DeepInserts(1) == 10)
+	Must(t, tree.DeepInserts(2) == 8)
+	Must(t, tree.DeepInserts(3) == 2)
+	Must(t, tree.DeepInserts(4) == 0)
+	// Deletes don't change the insert distribution.
+	tree.Delete(Uint32(9))
+	Must(t, tree.DeepInserts(3) == 2)
+}
+
+func TestResetStats(t *testing.T) {
+	tree := New()
+	for i := 0; i < 10; i++ {
+		tree.Put(Uint32(i))
+		tree.Put(Uint32(i))
+	}
+	Must(t, tree.Duplicates() == 10)
+	tree.ResetConflicts()
+	Must(t, tree.Duplicates() == 0)
+	Must(t, tree.DeepInserts(1) == 10)
+	tree.Put(Uint32(1))
+	tree.ResetStats()
+	Must(t, tree.Duplicates() == 0)
+	Must(t, tree.DeepInserts(1) == 0)
+	// Items are kept.
+	Must(t, tree.Len() == 10)
+	Must(t, tree.Get(Uint32(9)) == Uint32(9))
+}
+
+func TestLevelCounts(t *testing.T) {
+	/*
+	       root
+	     /     \
+	    0       1     %2
+	   /|\     /|\
+	  6 4 2   3 7 5   %3
+	      |   |
+	      8   9       %5
+	*/
+	tree := New()
+	Must(t, len(tree.LevelCounts()) == 10)
+	for i := 0; i < 10; i++ {
+		tree.Put(Uint32(i))
+	}
+	counts := tree.LevelCounts()
+	Must(t, counts[0] == 2)
+	Must(t, counts[1] == 6)
+	Must(t, counts[2] == 2)
+	Must(t, counts[3] == 0)
+	// Deleting 0 promotes the leaf 6 to depth 1.
+	tree.Delete(Uint32(0))
+	counts = tree.LevelCounts()
+	Must(t, counts[0] == 2)
+	Must(t, counts[1] == 5)
+	Must(t, counts[2] == 2)
+}
+
+func TestHeight(t *testing.T) {
+	tree := New()
+	Must(t, tree.Height() == 0)
+	for i := 0; i < 10; i++ {
+		tree.Put(Uint32(i))
+	}
+	Must(t, tree.Height() == 3)
+	tree.Delete(Uint32(8))
+	Must(t, tree.Height() == 3)
+	tree.Delete(Uint32(9))
+	Must(t, tree.Height() == 2)
+	for i := 0; i < 10; i++ {
+		tree.Delete(Uint32(i))
+	}
+	Must(t, tree.Height() == 0)
+}
+
+func TestHeightLarge(t *testing.T) {
+	tree := New()
+	items := make([]Uint32, 1024*10)
+	for i := range items {
+		items[i] = Uint32(rand.Uint32())
+		tree.Put(items[i])
+	}
+	for i, item := range items {
+		tree.Delete(item)
+		if i%100 != 0 {
+			continue
+		}
+		height := 0
+		counts := make([]int, 10)
+		iter := tree.NewIterator()
+		for iter.Next() {
+			depth := iter.depth
+			counts[depth-1]++
+			if depth > height {
+				height = depth
+			}
+		}
+		Must(t, tree.Height() == height)
+		for d, c := range tree.LevelCounts() {
+			Must(t, counts[d] == c)
+		}
+	}
+}
+
+func TestGeneration(t *testing.T) {
+	tree := New()
+	Must(t, tree.Generation() == 0)
+	tree.Put(Uint32(1))
+	tree.Put(Uint32(2))
+	Must(t, tree.Generation() == 2)
+	// Not modifications.
+	tree.Put(Uint32(1))
+	tree.Get(Uint32(1))
+	tree.Delete(Uint32(3))
+	tree.ResetStats()
+	Must(t, tree.Generation() == 2)
+	tree.Delete(Uint32(1))
+	Must(t, tree.Generation() == 3)
+}
+
 func TestGetN(t *testing.T) {
 	tree := New()
 	n := 1024
@@ -137,6 +320,54 @@ func TestGetN(t *testing.T) {
 	}
 }
 
+func TestKeyPath(t *testing.T) {
+	for i := 0; i < 1024; i++ {
+		key := rand.Uint32()
+		p := NewKeyPath(key)
+		Must(t, p.Key() == key)
+		for d := int8(0); d < int8(len(primes)); d++ {
+			Must(t, p.rs[d] == modulo(key, d))
+		}
+	}
+	tree := New()
+	p := NewKeyPath(42)
+	Must(t, tree.GetPath(p) == nil)
+	Must(t, tree.PutPath(p, Uint32(42)) == Uint32(42))
+	Must(t, tree.GetPath(p) == Uint32(42))
+	Must(t, tree.Get(Uint32(42)) == Uint32(42))
+	Must(t, tree.DeletePath(p) == Uint32(42))
+	Must(t, tree.GetPath(p) == nil)
+}
+
+func TestGetKey(t *testing.T) {
+	tree := New()
+	tree.Put(Uint32(1024))
+	Must(t, tree.GetKey(1024) == Uint32(1024))
+	Must(t, tree.GetKey(1025) == nil)
+}
+
+func TestGetZeroAllocs(t *testing.T) {
+	for _, tree := range []*HTree{New(), New(WithTimestamps())} {
+		var items []Item
+		for i := 0; i < 1024; i++ {
+			item := Uint32(rand.Uint32())
+			tree.Put(item)
+			items = append(items, item)
+		}
+		var probe Item = Uint32(rand.Uint32())
+		p := NewKeyPath(items[0].Key())
+		i := 0
+		Must(t, testing.AllocsPerRun(100, func() {
+			tree.Get(items[i%len(items)])
+			tree.Get(probe)
+			tree.GetKey(items[i%len(items)].Key())
+			tree.GetKey(uint32(i))
+			tree.GetPath(p)
+			i++
+		}) == 0)
+	}
+}
+
 func TestDeleteN(t *testing.T) {
 	tree := New()
 	n := 1024
@@ -172,14 +403,14 @@ func TestDeleteReplace(t *testing.T) {
 	// Must delete
 	Must(t, tree.Delete(item) == item)
 	// Original child must be replaced by new node:42
-	Must(t, tree.root.children[0].item == Uint32(42))
-	Must(t, tree.root.children[0].remainder == 0)
-	Must(t, tree.root.children[0].depth == 1)
+	Must(t, tree.root.children()[0].item == Uint32(42))
+	Must(t, tree.root.children()[0].remainder == 0)
+	Must(t, tree.Validate() == nil)
 	// The children shouldnt be changed
-	Must(t, len(tree.root.children[0].children) == 3)
+	Must(t, len(tree.root.children()[0].children()) == 3)
 	// Node must be a leaf now.
-	leaf := tree.root.children[0].children[0]
-	Must(t, len(leaf.children) == 0)
+	leaf := tree.root.children()[0].children()[0]
+	Must(t, len(leaf.children()) == 0)
 	// Must length--
 	Must(t, tree.Len() == 9)
 }
@@ -201,11 +432,247 @@ func TestDeleteLeaf(t *testing.T) {
 	// Must delete
 	Must(t, tree.Delete(item) == item)
 	// Must node(1) has 2 nodes now
-	Must(t, len(tree.root.children[1].children) == 2)
+	Must(t, len(tree.root.children()[1].children()) == 2)
 	// Must length--
 	Must(t, tree.Len() == 7)
 }
 
+func TestTimestamps(t *testing.T) {
+	tree := New(WithTimestamps())
+	for i := 0; i < 10; i++ {
+		Must(t, tree.Put(Uint32(i)) == Uint32(i))
+	}
+	Must(t, tree.Get(Uint32(3)) == Uint32(3))
+	Must(t, tree.Delete(Uint32(0)) == Uint32(0))
+	iter := tree.NewIterator()
+	n := 0
+	for iter.Next() {
+		n++
+		_, ok := iter.Item().(Uint32)
+		Must(t, ok)
+		Must(t, !iter.InsertedAt().IsZero())
+		Must(t, !iter.AccessedAt().Before(iter.InsertedAt()))
+	}
+	Must(t, n == 9)
+	// Disabled by default.
+	tree = New()
+	tree.Put(Uint32(1))
+	iter = tree.NewIterator()
+	Must(t, iter.Next() && iter.InsertedAt().IsZero())
+	Must(t, iter.AccessedAt().IsZero())
+}
+
+func TestTimestampsClock(t *testing.T) {
+	clock := &fakeClock{time.Unix(100, 0)}
+	tree := New(WithTimestamps(), WithClock(clock))
+	tree.Put(Uint32(1))
+	clock.now = time.Unix(200, 0)
+	tree.Get(Uint32(1))
+	iter := tree.NewIterator()
+	Must(t, iter.Next())
+	Must(t, iter.InsertedAt().Equal(time.Unix(100, 0)))
+	Must(t, iter.AccessedAt().Equal(time.Unix(200, 0)))
+}
+
+func TestReplacePath(t *testing.T) {
+	clock := &fakeClock{time.Unix(100, 0)}
+	tree := New(WithTimestamps(), WithClock(clock))
+	for i := uint32(0); i < 10; i++ {
+		tree.Put(csvItem{i, "a"})
+	}
+	c := tree.CloneCOW()
+	clock.now = time.Unix(200, 0)
+	// 1 is at depth 1 with children.
+	p := NewKeyPath(1)
+	Must(t, tree.replacePath(&p, csvItem{1, "b"}) == csvItem{1, "a"})
+	Must(t, tree.GetKey(1) == csvItem{1, "b"})
+	Must(t, c.GetKey(1) == csvItem{1, "a"})
+	Must(t, tree.Replace(csvItem{10, "b"}) == nil)
+	Must(t, tree.GetKey(10) == nil && tree.Len() == 10)
+	iter := tree.NewIterator()
+	for iter.Next() {
+		if iter.Item().Key() == 1 {
+			Must(t, iter.InsertedAt().Equal(time.Unix(100, 0)))
+			Must(t, iter.AccessedAt().Equal(time.Unix(200, 0)))
+		}
+	}
+	Must(t, tree.Validate() == nil && c.Validate() == nil)
+}
+
+func TestAny(t *testing.T) {
+	tree := New()
+	Must(t, tree.Any() == nil)
+	tree.Put(Uint32(3))
+	tree.Put(Uint32(4))
+	item := tree.Any()
+	Must(t, item == Uint32(3) || item == Uint32(4))
+	tree.Delete(item)
+	Must(t, tree.Any() != nil && tree.Any() != item)
+	tree.Delete(tree.Any())
+	Must(t, tree.Any() == nil)
+}
+
+// mustPanic asserts f panics with the given value.
+func mustPanic(t *testing.T, v interface{}, f func()) {
+	_, fileName, line, _ := runtime.Caller(1)
+	defer func() {
+		if r := recover(); r != v {
+			t.Errorf("\n unexcepted panic %v: %s:%d", r, fileName, line)
+		}
+	}()
+	f()
+}
+
+func TestFreeze(t *testing.T) {
+	clock := &fakeClock{time.Unix(100, 0)}
+	tree := New(WithTimestamps(), WithClock(clock))
+	for i := 0; i < 10; i++ {
+		tree.Put(Uint32(i))
+	}
+	Must(t, !tree.Frozen())
+	tree.Freeze()
+	Must(t, tree.Frozen())
+	mustPanic(t, ErrFrozen, func() { tree.Put(Uint32(10)) })
+	mustPanic(t, ErrFrozen, func() { tree.Put(Uint32(1)) })
+	mustPanic(t, ErrFrozen, func() { tree.Delete(Uint32(1)) })
+	Must(t, tree.Len() == 10)
+	// Reads don't touch.
+	clock.now = time.Unix(200, 0)
+	Must(t, tree.Get(Uint32(0)) == Uint32(0))
+	iter := tree.NewIterator()
+	Must(t, iter.Next() && iter.Item() == Uint32(0))
+	Must(t, iter.AccessedAt().Equal(time.Unix(100, 0)))
+}
+
+// mustEqual asserts the tree has exactly the items in the map.
+func mustEqual(t *testing.T, tree *HTree, m map[Uint32]bool) {
+	_, fileName, line, _ := runtime.Caller(1)
+	n := 0
+	iter := tree.NewIterator()
+	for iter.Next() {
+		n++
+		if !m[iter.Item().(Uint32)] {
+			t.Errorf("\n unexcepted item %v: %s:%d", iter.Item(), fileName, line)
+		}
+	}
+	if n != len(m) || tree.Len() != len(m) {
+		t.Errorf("\n unexcepted length %d: %s:%d", n, fileName, line)
+	}
+}
+
+func TestCloneCOW(t *testing.T) {
+	tree := New()
+	m := make(map[Uint32]bool)
+	for i := 0; i < 1024; i++ {
+		item := Uint32(rand.Intn(2048))
+		tree.Put(item)
+		m[item] = true
+	}
+	clone := tree.CloneCOW()
+	cm := make(map[Uint32]bool)
+	for item := range m {
+		cm[item] = true
+	}
+	mustEqual(t, clone, cm)
+	// Modify both.
+	for i := 0; i < 1024; i++ {
+		item := Uint32(rand.Intn(2048))
+		if rand.Intn(2) == 0 {
+			tree.Put(item)
+			m[item] = true
+		} else {
+			tree.Delete(item)
+			delete(m, item)
+		}
+		item = Uint32(rand.Intn(2048))
+		if rand.Intn(2) == 0 {
+			clone.Put(item)
+			cm[item] = true
+		} else {
+			clone.Delete(item)
+			delete(cm, item)
+		}
+	}
+	mustEqual(t, tree, m)
+	mustEqual(t, clone, cm)
+	// Clone of a frozen tree.
+	tree.Freeze()
+	clone = tree.CloneCOW()
+	Must(t, !clone.Frozen())
+	for item := range m {
+		Must(t, clone.Delete(item) == item)
+	}
+	Must(t, clone.Len() == 0)
+	mustEqual(t, tree, m)
+}
+
+func TestCloneCOWDeleteReplace(t *testing.T) {
+	tree := New()
+	for i := 0; i < 9; i++ {
+		tree.Put(Uint32(i))
+	}
+	tree.Put(Uint32(42))
+	clone := tree.CloneCOW()
+	Must(t, clone.Delete(Uint32(0)) == Uint32(0))
+	Must(t, clone.root.children()[0].item == Uint32(42))
+	Must(t, len(clone.root.children()[0].children()) == 3)
+	Must(t, len(clone.root.children()[0].children()[0].children()) == 0)
+	// The original is untouched.
+	Must(t, tree.root.children()[0].item == Uint32(0))
+	Must(t, tree.root.children()[0].children()[0].children()[0].item == Uint32(42))
+	Must(t, tree.Len() == 10)
+	Must(t, clone.Len() == 9)
+}
+
+func TestCopyTo(t *testing.T) {
+	src := New()
+	dst := New()
+	for i := 0; i < 100; i++ {
+		src.Put(Uint32(i))
+	}
+	for i := 50; i < 200; i++ {
+		dst.Put(Uint32(i))
+	}
+	Must(t, src.CopyTo(dst) == 50)
+	Must(t, dst.Len() == 200)
+	Must(t, src.Len() == 100)
+	for i := 0; i < 200; i++ {
+		Must(t, dst.Get(Uint32(i)) == Uint32(i))
+	}
+	Must(t, src.CopyTo(dst) == 0)
+}
+
+func TestAppendTo(t *testing.T) {
+	tree := New()
+	for i := 0; i < 100; i++ {
+		tree.Put(Uint32(i))
+	}
+	buf := tree.AppendTo(nil)
+	Must(t, len(buf) == 100)
+	iter := tree.NewIterator()
+	for i := 0; iter.Next(); i++ {
+		Must(t, buf[i] == iter.Item())
+	}
+	// Reuse the buffer.
+	buf = tree.AppendTo(buf[:1])
+	Must(t, len(buf) == 101)
+	Must(t, testing.AllocsPerRun(10, func() {
+		buf = tree.AppendTo(buf[:0])
+	}) == 0)
+}
+
+func TestCount(t *testing.T) {
+	tree := New()
+	Must(t, tree.Count(func(Item) bool { return true }) == 0)
+	for i := 0; i < 100; i++ {
+		tree.Put(Uint32(i))
+	}
+	even := func(item Item) bool { return item.Key()%2 == 0 }
+	Must(t, tree.Count(even) == 50)
+	Must(t, tree.Count(func(Item) bool { return true }) == 100)
+	Must(t, testing.AllocsPerRun(10, func() { tree.Count(even) }) == 0)
+}
+
 func TestIteratorEmpty(t *testing.T) {
 	tree := New()
 	i := 0
@@ -256,6 +723,296 @@ func TestIteratorLarge(t *testing.T) {
 	Must(t, j == tree.Len())
 }
 
+func TestIteratorPrev(t *testing.T) {
+	/*
+	      root
+	     /    \
+	    0      1     %2
+	   / \    / \
+	  4   2  3   5   %3
+	*/
+	tree := New()
+	for i := 0; i < 6; i++ {
+		tree.Put(Uint32(i))
+	}
+	iter := tree.NewIterator()
+	Must(t, !iter.Prev())
+	Must(t, iter.Next() && iter.Item() == Uint32(0))
+	Must(t, iter.Next() && iter.Item() == Uint32(4))
+	Must(t, iter.Next() && iter.Item() == Uint32(2))
+	Must(t, iter.Prev() && iter.Item() == Uint32(4))
+	Must(t, iter.Next() && iter.Item() == Uint32(2))
+	Must(t, iter.Next() && iter.Item() == Uint32(1))
+	Must(t, iter.Prev() && iter.Item() == Uint32(2))
+	Must(t, iter.Prev() && iter.Item() == Uint32(4))
+	Must(t, iter.Prev() && iter.Item() == Uint32(0))
+	// Before the first.
+	Must(t, !iter.Prev())
+	Must(t, !iter.Prev())
+	Must(t, iter.Next() && iter.Item() == Uint32(0))
+	for iter.Next() {
+	}
+	Must(t, !iter.Next())
+	// Back from the end.
+	Must(t, iter.Prev() && iter.Item() == Uint32(5))
+	Must(t, iter.Prev() && iter.Item() == Uint32(3))
+	Must(t, iter.Prev() && iter.Item() == Uint32(1))
+	Must(t, iter.Prev() && iter.Item() == Uint32(2))
+	visited, _ := iter.Progress()
+	Must(t, visited == 3)
+	// Empty tree.
+	iter = New().NewIterator()
+	Must(t, !iter.Next())
+	Must(t, !iter.Prev())
+}
+
+func TestIteratorPrevLarge(t *testing.T) {
+	tree := New()
+	for i := 0; i < 1024*10; i++ {
+		tree.Put(Uint32(rand.Uint32()))
+	}
+	items := tree.AppendTo(nil)
+	iter := tree.NewIterator()
+	for iter.Next() {
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		Must(t, iter.Prev() && iter.Item() == items[i])
+	}
+	Must(t, !iter.Prev())
+	for i := 0; i < len(items); i++ {
+		Must(t, iter.Next() && iter.Item() == items[i])
+	}
+	Must(t, !iter.Next())
+}
+
+func TestSnapshotIterator(t *testing.T) {
+	tree := New()
+	for i := 0; i < 100; i++ {
+		tree.Put(Uint32(i))
+	}
+	var expect []Item
+	tree.Walk(func(item Item) bool {
+		expect = append(expect, item)
+		return true
+	})
+	iter := tree.NewSnapshotIterator()
+	for i := 0; iter.Next(); i++ {
+		Must(t, iter.Item() == expect[i])
+		// Modify the tree while iterating.
+		tree.Delete(Uint32(i))
+		tree.Put(Uint32(1000 + i))
+	}
+	visited, total := iter.Progress()
+	Must(t, visited == 100 && total == 100)
+	Must(t, tree.Len() == 100)
+	Must(t, tree.Validate() == nil)
+}
+
+func TestIteratorZeroAllocs(t *testing.T) {
+	tree := New()
+	for i := 0; i < 1024; i++ {
+		tree.Put(Uint32(rand.Uint32()))
+	}
+	Must(t, testing.AllocsPerRun(10, func() {
+		iter := tree.NewIterator()
+		for iter.Next() {
+		}
+		for iter.Prev() {
+		}
+	}) == 0)
+}
+
+func TestIteratorNextChunk(t *testing.T) {
+	tree := New()
+	n := 1000
+	for i := 0; i < n; i++ {
+		tree.Put(Uint32(i))
+	}
+	seen := make(map[Item]bool)
+	chunk := make([]Item, 64)
+	iter := tree.NewIterator()
+	for {
+		k := iter.NextChunk(chunk)
+		if k == 0 {
+			break
+		}
+		Must(t, k == len(chunk) || len(seen)+k == n)
+		for _, item := range chunk[:k] {
+			seen[item] = true
+		}
+	}
+	Must(t, len(seen) == n)
+	Must(t, iter.NextChunk(chunk) == 0)
+}
+
+func TestIteratorClone(t *testing.T) {
+	/*
+	      root
+	     /    \
+	    0      1     %2
+	   / \    / \
+	  4   2  3   5   %3
+	*/
+	tree := New()
+	for i := 0; i < 6; i++ {
+		tree.Put(Uint32(i))
+	}
+	iter := tree.NewIterator()
+	Must(t, iter.Next() && iter.Item() == Uint32(0))
+	Must(t, iter.Next() && iter.Item() == Uint32(4))
+	c := iter.Clone()
+	Must(t, c.Item() == Uint32(4))
+	// Seek the clone to the end.
+	Must(t, c.Next() && c.Item() == Uint32(2))
+	Must(t, c.Next() && c.Item() == Uint32(1))
+	Must(t, c.Next() && c.Item() == Uint32(3))
+	Must(t, c.Next() && c.Item() == Uint32(5))
+	Must(t, !c.Next())
+	// The original stays.
+	Must(t, iter.Item() == Uint32(4))
+	Must(t, iter.Next() && iter.Item() == Uint32(2))
+	Must(t, iter.Next() && iter.Item() == Uint32(1))
+}
+
+func TestIteratorProgress(t *testing.T) {
+	tree := New()
+	for i := 0; i < 100; i++ {
+		tree.Put(Uint32(i))
+	}
+	iter := tree.NewIterator()
+	visited, total := iter.Progress()
+	Must(t, visited == 0 && total == 100)
+	for i := 1; iter.Next(); i++ {
+		visited, total = iter.Progress()
+		Must(t, visited == i && total == 100)
+	}
+	visited, total = iter.Progress()
+	Must(t, visited == 100 && total == 100)
+}
+
+func TestWalk(t *testing.T) {
+	tree := New()
+	for i := 0; i < 6; i++ {
+		tree.Put(Uint32(i))
+	}
+	var items []Item
+	tree.Walk(func(item Item) bool {
+		items = append(items, item)
+		return true
+	})
+	// Same order with the iterator.
+	iter := tree.NewIterator()
+	for i := 0; iter.Next(); i++ {
+		Must(t, items[i] == iter.Item())
+	}
+	Must(t, len(items) == 6)
+	// Stops.
+	n := 0
+	tree.Walk(func(item Item) bool {
+		n++
+		return n < 3
+	})
+	Must(t, n == 3)
+}
+
+func TestInt32(t *testing.T) {
+	values := []int32{math.MinInt32, -100, -1, 0, 1, 100, math.MaxInt32}
+	for i := 1; i < len(values); i++ {
+		Must(t, Int32(values[i-1]).Key() < Int32(values[i]).Key())
+	}
+	Must(t, Int32(math.MinInt32).Key() == 0)
+	Must(t, Int32(math.MaxInt32).Key() == math.MaxUint32)
+	tree := New(WithOrderedIndex())
+	for _, v := range values {
+		tree.Put(Int32(v))
+	}
+	Must(t, tree.Get(Int32(-1)) == Int32(-1))
+	Must(t, tree.Floor(Int32(-2).Key()) == Int32(-100))
+	Must(t, tree.Ceil(Int32(-2).Key()) == Int32(-1))
+}
+
+func TestNearest(t *testing.T) {
+	tree := New()
+	Must(t, tree.Nearest(1) == nil)
+	for _, key := range []uint32{10, 20, 40, 1 << 31} {
+		tree.Put(Uint32(key))
+	}
+	Must(t, tree.Nearest(20) == Uint32(20))
+	Must(t, tree.Nearest(0) == Uint32(10))
+	Must(t, tree.Nearest(26) == Uint32(20))
+	Must(t, tree.Nearest(30) == Uint32(20)) // ties to the smaller
+	Must(t, tree.Nearest(31) == Uint32(40))
+	Must(t, tree.Nearest(^uint32(0)) == Uint32(1<<31))
+}
+
+func TestMatchMask(t *testing.T) {
+	tree := New()
+	for typ := uint32(0); typ < 4; typ++ {
+		for id := uint32(0); id < 100; id++ {
+			tree.Put(Uint32(typ<<24 | id))
+		}
+	}
+	cases := []struct {
+		mask, pattern uint32
+		n             int
+	}{
+		{0xff000000, 2 << 24, 100},  // all of type 2
+		{0xff000001, 2<<24 | 1, 50}, // odd ids of type 2
+		{0xff000001, 5 << 24, 0},
+		{1, 0, 200},
+		{0, 0, 400},
+		{0xff, 0x100, 0}, // pattern out of mask
+	}
+	for _, c := range cases {
+		n := 0
+		tree.MatchMask(c.mask, c.pattern, func(item Item) bool {
+			Must(t, item.Key()&c.mask == c.pattern)
+			n++
+			return true
+		})
+		Must(t, n == c.n)
+	}
+	// Stops.
+	n := 0
+	tree.MatchMask(1, 1, func(item Item) bool {
+		n++
+		return n < 3
+	})
+	Must(t, n == 3)
+}
+
+func TestWalkCtx(t *testing.T) {
+	tree := New()
+	for i := 0; i < 10000; i++ {
+		tree.Put(Uint32(i))
+	}
+	n := 0
+	Must(t, tree.WalkCtx(context.Background(), func(item Item) bool {
+		n++
+		return true
+	}) == nil)
+	Must(t, n == 10000)
+	// Canceled during walking.
+	ctx, cancel := context.WithCancel(context.Background())
+	n = 0
+	err := tree.WalkCtx(ctx, func(item Item) bool {
+		n++
+		if n == 10 {
+			cancel()
+		}
+		return true
+	})
+	Must(t, err == context.Canceled)
+	Must(t, n == walkCheckInterval)
+	// Canceled before walking.
+	n = 0
+	Must(t, tree.WalkCtx(ctx, func(item Item) bool {
+		n++
+		return true
+	}) == context.Canceled)
+	Must(t, n == 0)
+}
+
 func BenchmarkPut(b *testing.B) {
 	t := New()
 	for i := 0; i < b.N; i++ {
@@ -286,6 +1043,45 @@ func BenchmarkIteratorNext(b *testing.B) {
 	}
 }
 
+func BenchmarkGetKey(b *testing.B) {
+	t := New()
+	for i := 0; i < b.N; i++ {
+		t.Put(Uint32(i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t.GetKey(uint32(i))
+	}
+}
+
+func BenchmarkGetPath(b *testing.B) {
+	t := New()
+	paths := make([]KeyPath, 1024)
+	for i := range paths {
+		paths[i] = NewKeyPath(rand.Uint32())
+		t.Put(Uint32(paths[i].Key()))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t.GetPath(paths[i%len(paths)])
+	}
+}
+
+func BenchmarkNewIterator(b *testing.B) {
+	t := New()
+	for i := 0; i < 1024; i++ {
+		t.Put(Uint32(i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		iter := t.NewIterator()
+		for j := 0; j < 16 && iter.Next(); j++ {
+		}
+	}
+}
+
 func BenchmarkGetLargeTree(b *testing.B) {
 	t := New()
 	n := 1000 * 1000 // Million
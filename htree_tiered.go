@@ -0,0 +1,127 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import "sort"
+
+// Backend is the cold storage of a Tiered tree, e.g. an adapter of an
+// embedded key-value store, it encodes the items itself.
+type Backend interface {
+	// Load returns the item with the key, nil if not found.
+	Load(key uint32) (Item, error)
+	// Store stores the item, replacing the one with the same key.
+	Store(item Item) error
+	// Delete deletes the item with the key, it's not an error if not found.
+	Delete(key uint32) error
+}
+
+// Tiered is a two-tier store, the htree is the hot tier holding at most a
+// given number of items, the coldest items by access time are spilled to
+// the backend on overflow, and loaded back on access. An item is in either
+// tier but never both. It's not safe for concurrent use.
+type Tiered struct {
+	t   *HTree
+	b   Backend
+	max int
+}
+
+// NewTiered creates a tiered store keeping at most max items in the htree,
+// the options apply to the htree, which is in the timestamps mode always.
+// On overflow, the coldest items are spilled till 7/8 of max are left, so
+// that the spills are batched.
+func NewTiered(b Backend, max int, opts ...Option) *Tiered {
+	if max < 1 {
+		max = 1
+	}
+	opts = append(opts[:len(opts):len(opts)], WithTimestamps())
+	return &Tiered{t: New(opts...), b: b, max: max}
+}
+
+// HotLen returns the number of items in the htree.
+func (s *Tiered) HotLen() int { return s.t.Len() }
+
+// Get returns the item with the key, nil if not found. An item found in the
+// backend is moved to the htree.
+func (s *Tiered) Get(key uint32) (Item, error) {
+	p := NewKeyPath(key)
+	if item := s.t.GetPath(p); item != nil {
+		return item, nil
+	}
+	item, err := s.b.Load(key)
+	if item == nil || err != nil {
+		return nil, err
+	}
+	return item, s.promote(p, item)
+}
+
+// Put puts the item and returns it, or the item already in either tier
+// with the same key, like HTree.Put. An item overflowing the depth of the
+// htree is stored to the backend directly.
+func (s *Tiered) Put(item Item) (Item, error) {
+	p := NewKeyPath(item.Key())
+	if old := s.t.GetPath(p); old != nil {
+		return old, nil
+	}
+	old, err := s.b.Load(item.Key())
+	if err != nil {
+		return nil, err
+	}
+	if old != nil {
+		return old, s.promote(p, old)
+	}
+	if s.t.PutPath(p, item) == nil {
+		return item, s.b.Store(item)
+	}
+	return item, s.spill()
+}
+
+// Delete deletes the item with the key from both tiers and returns it, nil
+// if not found.
+func (s *Tiered) Delete(key uint32) (Item, error) {
+	if item := s.t.DeletePath(NewKeyPath(key)); item != nil {
+		return item, nil
+	}
+	item, err := s.b.Load(key)
+	if item == nil || err != nil {
+		return nil, err
+	}
+	return item, s.b.Delete(key)
+}
+
+// promote moves the item loaded from the backend to the htree, it's left
+// in the backend if the depth overflows.
+func (s *Tiered) promote(p KeyPath, item Item) error {
+	if s.t.PutPath(p, item) == nil {
+		return nil
+	}
+	if err := s.b.Delete(p.key); err != nil {
+		s.t.DeletePath(p)
+		return err
+	}
+	return s.spill()
+}
+
+// spill moves the coldest items to the backend if the htree overflows. On
+// an error, the items not stored yet are kept in the htree.
+func (s *Tiered) spill() error {
+	if s.t.Len() <= s.max {
+		return nil
+	}
+	type cold struct {
+		item     Item
+		accessed int64
+	}
+	items := make([]cold, 0, s.t.Len())
+	iter := s.t.NewIterator()
+	for iter.Next() {
+		items = append(items, cold{iter.Item(), iter.AccessedAt().UnixNano()})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].accessed < items[j].accessed })
+	for _, c := range items[:s.t.Len()-s.max*7/8] {
+		if err := s.b.Store(c.item); err != nil {
+			return err
+		}
+		s.t.DeletePath(NewKeyPath(c.item.Key()))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// mapBackend is a backend on a map, fails the stores once full.
+type mapBackend struct {
+	items map[uint32]Item
+	max   int
+}
+
+var errFull = errors.New("backend full")
+
+func (b *mapBackend) Load(key uint32) (Item, error) { return b.items[key], nil }
+func (b *mapBackend) Delete(key uint32) error       { delete(b.items, key); return nil }
+func (b *mapBackend) Store(item Item) error {
+	if len(b.items) >= b.max {
+		return errFull
+	}
+	b.items[item.Key()] = item
+	return nil
+}
+
+func TestTiered(t *testing.T) {
+	clock := &fakeClock{time.Unix(100, 0)}
+	b := &mapBackend{map[uint32]Item{}, 100}
+	s := NewTiered(b, 8, WithClock(clock))
+	for i := 0; i < 9; i++ {
+		clock.now = clock.now.Add(time.Second)
+		item, err := s.Put(Uint32(i))
+		Must(t, err == nil && item == Uint32(i))
+	}
+	// Spills the coldest till 7 left.
+	Must(t, s.HotLen() == 7 && len(b.items) == 2)
+	Must(t, b.items[0] == Uint32(0) && b.items[1] == Uint32(1))
+	// Put on a cold key returns it.
+	item, err := s.Put(Uint32(0))
+	Must(t, err == nil && item == Uint32(0))
+	Must(t, s.HotLen() == 8 && len(b.items) == 1)
+	// Loads back.
+	item, err = s.Get(1)
+	Must(t, err == nil && item == Uint32(1))
+	Must(t, s.HotLen() == 7 && len(b.items) == 2)
+	item, err = s.Get(100)
+	Must(t, err == nil && item == nil)
+	// Deletes from either tier.
+	for i := uint32(0); i < 9; i++ {
+		item, err := s.Delete(i)
+		Must(t, err == nil && item == Uint32(i))
+	}
+	Must(t, s.HotLen() == 0 && len(b.items) == 0)
+	item, err = s.Delete(0)
+	Must(t, err == nil && item == nil)
+}
+
+func TestTieredStoreError(t *testing.T) {
+	b := &mapBackend{map[uint32]Item{}, 1}
+	s := NewTiered(b, 8)
+	for i := 0; i < 8; i++ {
+		s.Put(Uint32(i))
+	}
+	_, err := s.Put(Uint32(8))
+	Must(t, err == errFull)
+	// Kept in the htree.
+	Must(t, s.HotLen() == 8 && len(b.items) == 1)
+	for i := uint32(0); i < 9; i++ {
+		item, _ := s.Get(i)
+		Must(t, item == Uint32(i))
+	}
+}
+
+func TestTieredOverflow(t *testing.T) {
+	b := &mapBackend{map[uint32]Item{}, 100}
+	s := NewTiered(b, 100)
+	// Keys sharing all the remainders of the first 9 primes.
+	step := uint32(2 * 3 * 5 * 7 * 11 * 13 * 17 * 19 * 23)
+	for i := uint32(0); i < 10; i++ {
+		s.Put(Uint32(i * step))
+	}
+	Must(t, s.HotLen() == 9 && b.items[9*step] == Uint32(9*step))
+	item, err := s.Get(9 * step)
+	Must(t, err == nil && item == Uint32(9*step))
+	Must(t, len(b.items) == 1)
+}
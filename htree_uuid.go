@@ -0,0 +1,158 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import "encoding/binary"
+
+// UUID is a 128-bit key, e.g. an UUID.
+type UUID [16]byte
+
+// word returns the i-th 32-bit word of the key.
+func (id *UUID) word(i int) uint32 { return binary.BigEndian.Uint32(id[4*i:]) }
+
+// UUIDTree maps 128-bit keys to values of V exactly, by chaining htrees
+// over the four 32-bit words of the keys. A tree at a level is keyed by the
+// word of the level, an entry holds the value directly until another key
+// shares the words so far, then a tree of the next level is chained. So
+// random UUIDs mostly take a single level, with the same memory cost as
+// the htree.
+type UUIDTree[V any] struct {
+	root   *HTree
+	length int
+}
+
+// uuidLeaf is an entry of a value, keyed by the word at its level.
+type uuidLeaf[V any] struct {
+	key   uint32
+	id    UUID
+	value V
+}
+
+// Key returns the word of the key at the level.
+func (l *uuidLeaf[V]) Key() uint32 { return l.key }
+
+// uuidBranch is an entry chaining the tree of the next level.
+type uuidBranch struct {
+	key  uint32
+	tree *HTree
+}
+
+// Key returns the word of the keys at the level.
+func (b *uuidBranch) Key() uint32 { return b.key }
+
+// NewUUIDTree creates an empty tree of 128-bit keys.
+func NewUUIDTree[V any]() *UUIDTree[V] {
+	return &UUIDTree[V]{root: New()}
+}
+
+// Len returns the number of values in the tree.
+func (u *UUIDTree[V]) Len() int { return u.length }
+
+// Get returns the value of the key, false if not found.
+func (u *UUIDTree[V]) Get(id UUID) (V, bool) {
+	t := u.root
+	for level := 0; level < 4; level++ {
+		switch e := t.GetKey(id.word(level)).(type) {
+		case *uuidLeaf[V]:
+			if e.id == id {
+				return e.value, true
+			}
+		case *uuidBranch:
+			t = e.tree
+			continue
+		}
+		break
+	}
+	var zero V
+	return zero, false
+}
+
+// Put puts the value of the key and returns it, or the value already in the
+// tree of the key. It returns false if the depth of a level overflows, see
+// HTree.Put.
+func (u *UUIDTree[V]) Put(id UUID, v V) (V, bool) {
+	var zero V
+	t := u.root
+	for level := 0; level < 4; level++ {
+		w := id.word(level)
+		switch e := t.GetKey(w).(type) {
+		case nil:
+			if t.Put(&uuidLeaf[V]{w, id, v}) == nil {
+				return zero, false
+			}
+			u.length++
+			return v, true
+		case *uuidLeaf[V]:
+			if e.id == id {
+				return e.value, true
+			}
+			// Chain the next level, the words at the last level are
+			// unique, never reach here.
+			next := New()
+			next.Put(&uuidLeaf[V]{e.id.word(level + 1), e.id, e.value})
+			p := NewKeyPath(w)
+			t.replacePath(&p, &uuidBranch{w, next})
+			t = next
+		case *uuidBranch:
+			t = e.tree
+		}
+	}
+	return zero, false
+}
+
+// Delete deletes the value of the key and returns it, false if not found.
+func (u *UUIDTree[V]) Delete(id UUID) (V, bool) {
+	v, ok := u.delete(u.root, id, 0)
+	if ok {
+		u.length--
+	}
+	return v, ok
+}
+
+// delete deletes the value of the key from the tree t at the level, a
+// chained tree left with a single value is collapsed into its entry.
+func (u *UUIDTree[V]) delete(t *HTree, id UUID, level int) (V, bool) {
+	var zero V
+	w := id.word(level)
+	switch e := t.GetKey(w).(type) {
+	case *uuidLeaf[V]:
+		if e.id == id {
+			t.Delete(e)
+			return e.value, true
+		}
+	case *uuidBranch:
+		v, ok := u.delete(e.tree, id, level+1)
+		if !ok {
+			return zero, false
+		}
+		if e.tree.Len() == 1 {
+			if l, ok := e.tree.Any().(*uuidLeaf[V]); ok {
+				p := NewKeyPath(w)
+				t.replacePath(&p, &uuidLeaf[V]{w, l.id, l.value})
+			}
+		}
+		return v, true
+	}
+	return zero, false
+}
+
+// Walk calls f on each key and value, stops if f returns false.
+func (u *UUIDTree[V]) Walk(f func(UUID, V) bool) {
+	u.walk(u.root, f)
+}
+
+// walk calls f on the keys and values in the tree t recursively, returns
+// false if f stops the walking.
+func (u *UUIDTree[V]) walk(t *HTree, f func(UUID, V) bool) bool {
+	ok := true
+	t.Walk(func(item Item) bool {
+		switch e := item.(type) {
+		case *uuidLeaf[V]:
+			ok = f(e.id, e.value)
+		case *uuidBranch:
+			ok = u.walk(e.tree, f)
+		}
+		return ok
+	})
+	return ok
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+func TestUUIDTree(t *testing.T) {
+	u := NewUUIDTree[int]()
+	model := map[UUID]int{}
+	for i := 0; i < 5000; i++ {
+		var id UUID
+		rand.Read(id[:])
+		if i%3 == 0 {
+			// Share the leading words with another key.
+			for k := range model {
+				copy(id[:4*(i%4)], k[:])
+				break
+			}
+		}
+		v, ok := u.Put(id, i)
+		Must(t, ok)
+		if old, found := model[id]; found {
+			Must(t, v == old)
+		} else {
+			Must(t, v == i)
+			model[id] = i
+		}
+	}
+	Must(t, u.Len() == len(model))
+	n := 0
+	u.Walk(func(id UUID, v int) bool {
+		Must(t, model[id] == v)
+		n++
+		return true
+	})
+	Must(t, n == len(model))
+	for id, v := range model {
+		got, ok := u.Get(id)
+		Must(t, ok && got == v)
+	}
+	for id, v := range model {
+		got, ok := u.Delete(id)
+		Must(t, ok && got == v)
+		_, ok = u.Get(id)
+		Must(t, !ok)
+	}
+	Must(t, u.Len() == 0 && u.root.Len() == 0)
+}
+
+func TestUUIDTreeChain(t *testing.T) {
+	u := NewUUIDTree[string]()
+	a := UUID{0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 4}
+	b := a
+	b[15] = 5 // differs at the last word only
+	u.Put(a, "a")
+	u.Put(b, "b")
+	Must(t, u.root.Len() == 1)
+	va, _ := u.Get(a)
+	vb, _ := u.Get(b)
+	Must(t, va == "a" && vb == "b")
+	c := a
+	c[14] = 1
+	_, ok := u.Get(c)
+	Must(t, !ok)
+	_, ok = u.Delete(c)
+	Must(t, !ok)
+	// Collapses back to a single level.
+	u.Delete(a)
+	_, ok = u.root.Any().(*uuidLeaf[string])
+	Must(t, ok)
+	vb, _ = u.Get(b)
+	Must(t, vb == "b")
+}
+
+// residueUUID returns a key whose first word is w.
+func residueUUID(w uint32, rest byte) UUID {
+	id := UUID{15: rest}
+	binary.BigEndian.PutUint32(id[:], w)
+	return id
+}
+
+func TestUUIDTreeChainDeep(t *testing.T) {
+	u := NewUUIDTree[int]()
+	// Word 2 at depth 1, 0 under it at depth 2 on the first remainder, and
+	// the words sharing all the remainders of the first 9 primes with 2 on
+	// the depths 2 to 9. Chaining 2 deletes and re-puts it on a full path.
+	step := uint32(2 * 3 * 5 * 7 * 11 * 13 * 17 * 19 * 23)
+	words := []uint32{2, 0}
+	for i := uint32(1); i < 9; i++ {
+		words = append(words, 2+i*step)
+	}
+	for i, w := range words {
+		_, ok := u.Put(residueUUID(w, 0), i)
+		Must(t, ok)
+	}
+	Must(t, u.root.Height() == 9)
+	v, ok := u.Put(residueUUID(2, 1), 100)
+	Must(t, ok && v == 100)
+	Must(t, u.Len() == len(words)+1)
+	for i, w := range words {
+		v, ok := u.Get(residueUUID(w, 0))
+		Must(t, ok && v == i)
+	}
+	// Collapses the chain on the same node.
+	v, ok = u.Delete(residueUUID(2, 1))
+	Must(t, ok && v == 100)
+	for i, w := range words {
+		v, ok := u.Get(residueUUID(w, 0))
+		Must(t, ok && v == i)
+	}
+	Must(t, u.Len() == len(words))
+	Must(t, u.root.Validate() == nil)
+}
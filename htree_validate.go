@@ -0,0 +1,147 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import "fmt"
+
+// validator checks the invariants of a htree.
+type validator struct {
+	t      *HTree
+	keys   [10]uint32 // keys of the ancestors
+	length int
+	levels [10]int
+}
+
+// Validate checks the internal invariants of the htree, returns the first
+// violation found, nil if the tree is sound. It walks the whole tree and is
+// intended for tests and soak runs.
+func (t *HTree) Validate() error {
+	v := &validator{t: t}
+	if err := v.node(t.root, 0); err != nil {
+		return err
+	}
+	if v.length != t.length {
+		return fmt.Errorf("htree: length %d, counted %d", t.length, v.length)
+	}
+	height := 0
+	for d, count := range v.levels {
+		if count != t.levels[d] {
+			return fmt.Errorf("htree: %d items at depth %d, counted %d", t.levels[d], d+1, count)
+		}
+		if count > 0 {
+			height = d + 1
+		}
+	}
+	if height != t.height {
+		return fmt.Errorf("htree: height %d, counted %d", t.height, height)
+	}
+	if t.index != nil {
+		if err := v.index(); err != nil {
+			return err
+		}
+	}
+	if t.secondaries != nil {
+		return v.secondaries()
+	}
+	return nil
+}
+
+// secondaries checks the secondary indexes hold the items in the tree by
+// their secondary keys.
+func (v *validator) secondaries() error {
+	for name, s := range v.t.secondaries.byName {
+		n := 0
+		var err error
+		s.tree.Walk(func(item Item) bool {
+			b := item.(*bucket)
+			for _, x := range b.items {
+				if key := s.fn(x); key != b.key {
+					err = fmt.Errorf("htree: item %d with secondary key %d in bucket %d of index %s", x.Key(), key, b.key, name)
+					return false
+				}
+				p := NewKeyPath(x.Key())
+				if v.t.get(v.t.root, 0, &p) == nil {
+					err = fmt.Errorf("htree: item %d in index %s not found", x.Key(), name)
+					return false
+				}
+				n++
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if n > v.t.length {
+			return fmt.Errorf("htree: %d items in index %s, length %d", n, name, v.t.length)
+		}
+	}
+	return nil
+}
+
+// index checks the ordered index holds exactly the keys in the tree.
+func (v *validator) index() error {
+	n := 0
+	prev := int64(-1)
+	for _, b := range v.t.index.blocks {
+		if len(b.keys) == 0 || len(b.keys) > indexBlock {
+			return fmt.Errorf("htree: %d keys in an index block", len(b.keys))
+		}
+		if v.t.index.owner != v.t.owner && b.owner == v.t.owner {
+			return fmt.Errorf("htree: owned index block under a shared index")
+		}
+		for _, key := range b.keys {
+			if int64(key) <= prev {
+				return fmt.Errorf("htree: indexed key %d out of order", key)
+			}
+			prev = int64(key)
+			p := NewKeyPath(key)
+			if v.t.get(v.t.root, 0, &p) == nil {
+				return fmt.Errorf("htree: indexed key %d not found", key)
+			}
+			n++
+		}
+	}
+	if n != v.t.length {
+		return fmt.Errorf("htree: %d keys indexed, length %d", n, v.t.length)
+	}
+	return nil
+}
+
+// node checks the children of node n recursively, depth is of node n.
+func (v *validator) node(n *node, depth int8) error {
+	children := n.children()
+	for i, child := range children {
+		if child.item == nil {
+			return fmt.Errorf("htree: nil item at depth %d", depth+1)
+		}
+		key := child.item.Key()
+		if i > 0 && child.remainder <= children[i-1].remainder {
+			return fmt.Errorf("htree: key %d out of order", key)
+		}
+		if n.owner != v.t.owner && child.owner == v.t.owner {
+			return fmt.Errorf("htree: owned key %d under a shared node", key)
+		}
+		if depth >= int8(len(primes)) {
+			return fmt.Errorf("htree: key %d at depth %d", key, depth+1)
+		}
+		// The key must follow the remainders on the path.
+		if modulo(key, depth) != child.remainder {
+			return fmt.Errorf("htree: key %d remainder %d at depth %d", key, child.remainder, depth+1)
+		}
+		for d := int8(0); d < depth; d++ {
+			if key == v.keys[d] {
+				return fmt.Errorf("htree: key %d duplicated at depth %d", key, depth+1)
+			}
+			if modulo(key, d) != modulo(v.keys[d], d) {
+				return fmt.Errorf("htree: key %d misplaced at depth %d", key, depth+1)
+			}
+		}
+		v.length++
+		v.levels[depth]++
+		v.keys[depth] = key
+		if err := v.node(child, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tree := New()
+	Must(t, tree.Validate() == nil)
+	for i := 0; i < 1024*10; i++ {
+		tree.Put(Uint32(rand.Intn(1 << 16)))
+		tree.Delete(Uint32(rand.Intn(1 << 16)))
+	}
+	Must(t, tree.Validate() == nil)
+	clone := tree.CloneCOW()
+	for i := 0; i < 1024; i++ {
+		clone.Delete(Uint32(rand.Intn(1 << 16)))
+	}
+	Must(t, tree.Validate() == nil)
+	Must(t, clone.Validate() == nil)
+}
+
+func TestValidateViolations(t *testing.T) {
+	tree := New()
+	for i := 0; i < 10; i++ {
+		tree.Put(Uint32(i))
+	}
+	// Misplaced key.
+	tree.root.children()[0].children()[1].item = Uint32(7)
+	Must(t, tree.Validate() != nil)
+	tree.root.children()[0].children()[1].item = Uint32(4)
+	Must(t, tree.Validate() == nil)
+	// Out of order.
+	c := tree.root.children()[1].children()
+	c[0], c[1] = c[1], c[0]
+	Must(t, tree.Validate() != nil)
+	c[0], c[1] = c[1], c[0]
+	// Bad length.
+	tree.length++
+	Must(t, tree.Validate() != nil)
+	tree.length--
+	// Bad height.
+	tree.height++
+	Must(t, tree.Validate() != nil)
+}
@@ -0,0 +1,178 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+// Package htreetest provides a model-based checker for htree, it applies
+// operation sequences to both a htree and a map reference, and reports any
+// divergence.
+package htreetest // import "github.com/hit9/htree/htreetest"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+
+	"github.com/hit9/htree"
+)
+
+// Kind is the kind of an operation.
+type Kind uint8
+
+// Operation kinds.
+const (
+	Get Kind = iota
+	Put
+	Delete
+	numKinds
+)
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	switch k {
+	case Get:
+		return "Get"
+	case Put:
+		return "Put"
+	case Delete:
+		return "Delete"
+	}
+	return fmt.Sprintf("Kind(%d)", k)
+}
+
+// Op is a single operation on the tree.
+type Op struct {
+	Kind Kind
+	Key  uint32
+}
+
+// String returns the op in the form of "Put(123)".
+func (op Op) String() string {
+	return fmt.Sprintf("%s(%d)", op.Kind, op.Key)
+}
+
+// RandomOps returns n random operations with keys in [0, space), a small
+// key space exercises duplicate puts and deletes of existing keys.
+func RandomOps(r *rand.Rand, n int, space uint32) []Op {
+	ops := make([]Op, n)
+	for i := range ops {
+		ops[i] = Op{Kind(r.Intn(int(numKinds))), uint32(r.Int63n(int64(space)))}
+	}
+	return ops
+}
+
+// DecodeOps decodes operations from bytes, each operation takes 5 bytes,
+// one for the kind and four for the big endian key. Trailing bytes are
+// ignored. It's used to build operations from fuzzing inputs.
+func DecodeOps(data []byte) []Op {
+	ops := make([]Op, 0, len(data)/5)
+	for ; len(data) >= 5; data = data[5:] {
+		ops = append(ops, Op{Kind(data[0] % byte(numKinds)), binary.BigEndian.Uint32(data[1:])})
+	}
+	return ops
+}
+
+// Checker applies operations to both a htree and a map reference.
+type Checker struct {
+	Tree  *htree.HTree
+	Model map[uint32]bool
+}
+
+// NewChecker creates a checker on the tree, the model is initialized with
+// the items already in the tree.
+func NewChecker(tree *htree.HTree) *Checker {
+	c := &Checker{Tree: tree, Model: make(map[uint32]bool)}
+	tree.Walk(func(item htree.Item) bool {
+		c.Model[item.Key()] = true
+		return true
+	})
+	return c
+}
+
+// Apply applies the operation to the tree and the model, returns an error
+// if the results diverge.
+func (c *Checker) Apply(op Op) error {
+	switch op.Kind {
+	case Get:
+		item := c.Tree.Get(htree.Uint32(op.Key))
+		if c.Model[op.Key] != (item != nil) {
+			return fmt.Errorf("htreetest: %v got %v", op, item)
+		}
+		if item != nil && item.Key() != op.Key {
+			return fmt.Errorf("htreetest: %v got key %d", op, item.Key())
+		}
+	case Put:
+		item := c.Tree.Put(htree.Uint32(op.Key))
+		if item == nil {
+			if c.Model[op.Key] {
+				return fmt.Errorf("htreetest: %v overflows on existing key", op)
+			}
+			// Depth overflows, the key is not inserted.
+			return nil
+		}
+		if item.Key() != op.Key {
+			return fmt.Errorf("htreetest: %v got key %d", op, item.Key())
+		}
+		c.Model[op.Key] = true
+	case Delete:
+		item := c.Tree.Delete(htree.Uint32(op.Key))
+		if c.Model[op.Key] != (item != nil) {
+			return fmt.Errorf("htreetest: %v got %v", op, item)
+		}
+		if item != nil && item.Key() != op.Key {
+			return fmt.Errorf("htreetest: %v got key %d", op, item.Key())
+		}
+		delete(c.Model, op.Key)
+	default:
+		return fmt.Errorf("htreetest: unknown op %v", op)
+	}
+	return nil
+}
+
+// Check validates the tree invariants and compares the whole tree with the
+// model.
+func (c *Checker) Check() error {
+	if err := c.Tree.Validate(); err != nil {
+		return err
+	}
+	if c.Tree.Len() != len(c.Model) {
+		return fmt.Errorf("htreetest: length %d, want %d", c.Tree.Len(), len(c.Model))
+	}
+	seen := make(map[uint32]bool, len(c.Model))
+	var err error
+	c.Tree.Walk(func(item htree.Item) bool {
+		switch key := item.Key(); {
+		case seen[key]:
+			err = fmt.Errorf("htreetest: key %d walked twice", key)
+		case !c.Model[key]:
+			err = fmt.Errorf("htreetest: unexpected key %d", key)
+		default:
+			seen[key] = true
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	for key := range c.Model {
+		if item := c.Tree.Get(htree.Uint32(key)); item == nil || item.Key() != key {
+			return fmt.Errorf("htreetest: key %d got %v", key, item)
+		}
+	}
+	return nil
+}
+
+// Run applies the operations with a checker, and checks the tree every
+// interval operations and at the end, interval <= 0 checks only at the end.
+// Returns the first divergence.
+func Run(tree *htree.HTree, ops []Op, interval int) error {
+	c := NewChecker(tree)
+	for i, op := range ops {
+		if err := c.Apply(op); err != nil {
+			return fmt.Errorf("op #%d: %w", i, err)
+		}
+		if interval > 0 && (i+1)%interval == 0 {
+			if err := c.Check(); err != nil {
+				return fmt.Errorf("op #%d: %w", i, err)
+			}
+		}
+	}
+	return c.Check()
+}
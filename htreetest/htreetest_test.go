@@ -0,0 +1,71 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package htreetest
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/hit9/htree"
+)
+
+func TestRandomOps(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, space := range []uint32{16, 1024, 1 << 20} {
+		if err := Run(htree.New(), RandomOps(r, 10000, space), 1000); err != nil {
+			t.Errorf("space %d: %v", space, err)
+		}
+	}
+}
+
+func TestDecodeOps(t *testing.T) {
+	ops := DecodeOps([]byte{1, 0, 0, 1, 2, 5, 0, 0, 0, 3, 9})
+	if len(ops) != 2 || ops[0] != (Op{Put, 258}) || ops[1] != (Op{Delete, 3}) {
+		t.Errorf("unexpected ops %v", ops)
+	}
+}
+
+func TestCheckerDiverge(t *testing.T) {
+	tree := htree.New()
+	c := NewChecker(tree)
+	tree.Put(htree.Uint32(1))
+	if c.Apply(Op{Get, 1}) == nil {
+		t.Errorf("divergence not detected")
+	}
+	if c.Check() == nil {
+		t.Errorf("divergence not detected")
+	}
+}
+
+func FuzzHTree(f *testing.F) {
+	f.Add([]byte{1, 0, 0, 0, 0, 1, 0, 0, 0, 6, 2, 0, 0, 0, 0})
+	f.Add([]byte{1, 0, 0, 0, 12, 1, 0, 0, 0, 6, 1, 0, 0, 0, 42, 2, 0, 0, 0, 12})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := Run(htree.New(), DecodeOps(data), 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func FuzzCloneCOW(f *testing.F) {
+	f.Add([]byte{1, 0, 0, 0, 12, 1, 0, 0, 0, 6, 1, 0, 0, 0, 42, 2, 0, 0, 0, 12}, uint8(2))
+	f.Fuzz(func(t *testing.T, data []byte, at uint8) {
+		ops := DecodeOps(data)
+		if int(at) > len(ops) {
+			at = uint8(len(ops))
+		}
+		c := NewChecker(htree.New())
+		for _, op := range ops[:at] {
+			if err := c.Apply(op); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Apply the rest on the clone, the original must stay.
+		if err := Run(c.Tree.CloneCOW(), ops[at:], 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Check(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
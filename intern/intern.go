@@ -0,0 +1,107 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+// Package intern assigns stable uint32 IDs to strings, e.g. the labels in
+// metrics pipelines. The strings are indexed by their hashes in a htree,
+// and the IDs are dense, assigned from 0 in the interning order.
+//
+// Example:
+//
+//	table := intern.New()
+//	id := table.Intern("region=us-east")
+//	s := table.Lookup(id)
+package intern // import "github.com/hit9/htree/intern"
+
+import (
+	"hash/maphash"
+
+	"github.com/hit9/htree"
+)
+
+// entry is a string in the hash index, strings with the same hash are
+// chained.
+type entry struct {
+	hash uint32
+	id   uint32
+	next *entry
+}
+
+// Key returns the hash of the string.
+func (e *entry) Key() uint32 { return e.hash }
+
+// Table is an interning table, it's not safe for concurrent use.
+type Table struct {
+	hash     func(string) uint32
+	index    *htree.HTree      // hash to entries
+	overflow map[string]uint32 // ids of the strings the index can't place
+	strings  []string          // strings by id
+}
+
+// New creates an interning table.
+func New() *Table {
+	seed := maphash.MakeSeed()
+	return &Table{
+		hash:  func(s string) uint32 { return uint32(maphash.String(seed, s)) },
+		index: htree.New(),
+	}
+}
+
+// find returns the entry of the string, nil if not found, and the head of
+// the chain of its hash.
+func (t *Table) find(s string, hash uint32) (*entry, *entry) {
+	item := t.index.GetKey(hash)
+	if item == nil {
+		return nil, nil
+	}
+	head := item.(*entry)
+	for e := head; e != nil; e = e.next {
+		if t.strings[e.id] == s {
+			return e, head
+		}
+	}
+	return nil, head
+}
+
+// Intern returns the ID of the string, assigns the next one if it's new.
+func (t *Table) Intern(s string) uint32 {
+	hash := t.hash(s)
+	e, head := t.find(s, hash)
+	if e != nil {
+		return e.id
+	}
+	if id, ok := t.overflow[s]; ok {
+		return id
+	}
+	id := uint32(len(t.strings))
+	t.strings = append(t.strings, s)
+	switch {
+	case head != nil:
+		head.next = &entry{hash: hash, id: id, next: head.next}
+	case t.index.Put(&entry{hash: hash, id: id}) == nil:
+		// The hash overflows the depth of the index.
+		if t.overflow == nil {
+			t.overflow = map[string]uint32{}
+		}
+		t.overflow[s] = id
+	}
+	return id
+}
+
+// ID returns the ID of the string if it's interned.
+func (t *Table) ID(s string) (uint32, bool) {
+	if e, _ := t.find(s, t.hash(s)); e != nil {
+		return e.id, true
+	}
+	id, ok := t.overflow[s]
+	return id, ok
+}
+
+// Lookup returns the string of the ID, "" if it's not assigned.
+func (t *Table) Lookup(id uint32) string {
+	if int(id) >= len(t.strings) {
+		return ""
+	}
+	return t.strings[id]
+}
+
+// Len returns the number of strings interned.
+func (t *Table) Len() int { return len(t.strings) }
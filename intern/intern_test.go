@@ -0,0 +1,81 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package intern
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestTable(t *testing.T) {
+	table := New()
+	for i := 0; i < 10000; i++ {
+		if id := table.Intern(strconv.Itoa(i)); id != uint32(i) {
+			t.Fatalf("unexpected id %d of %d", id, i)
+		}
+	}
+	for i := 0; i < 10000; i++ {
+		s := strconv.Itoa(i)
+		if table.Intern(s) != uint32(i) || table.Lookup(uint32(i)) != s {
+			t.Fatalf("unstable id of %s", s)
+		}
+		if id, ok := table.ID(s); !ok || id != uint32(i) {
+			t.Fatalf("unexpected id of %s", s)
+		}
+	}
+	if _, ok := table.ID("x"); ok {
+		t.Error("unexpected id of x")
+	}
+	if table.Lookup(10000) != "" || table.Len() != 10000 {
+		t.Error("unexpected table")
+	}
+}
+
+func TestTableCollisions(t *testing.T) {
+	table := New()
+	// All strings on the same hash.
+	table.hash = func(string) uint32 { return 7 }
+	for i, s := range []string{"a", "b", "c"} {
+		if table.Intern(s) != uint32(i) {
+			t.Fatalf("unexpected id of %s", s)
+		}
+	}
+	for i, s := range []string{"a", "b", "c"} {
+		if id, ok := table.ID(s); !ok || id != uint32(i) {
+			t.Fatalf("unexpected id of %s", s)
+		}
+	}
+	if table.index.Len() != 1 {
+		t.Errorf("unexpected index length %d", table.index.Len())
+	}
+}
+
+func TestTableOverflow(t *testing.T) {
+	table := New()
+	// Hashes sharing all the remainders of the first 9 primes.
+	step := uint32(2 * 3 * 5 * 7 * 11 * 13 * 17 * 19 * 23)
+	table.hash = func(s string) uint32 {
+		i, _ := strconv.Atoi(s)
+		return uint32(i) * step
+	}
+	for i := 0; i < 12; i++ {
+		if id := table.Intern(strconv.Itoa(i)); id != uint32(i) {
+			t.Fatalf("unexpected id %d of %d", id, i)
+		}
+	}
+	if table.index.Len() != 9 {
+		t.Fatalf("unexpected index length %d", table.index.Len())
+	}
+	for i := 0; i < 12; i++ {
+		s := strconv.Itoa(i)
+		if table.Intern(s) != uint32(i) {
+			t.Fatalf("unstable id of %s", s)
+		}
+		if id, ok := table.ID(s); !ok || id != uint32(i) {
+			t.Fatalf("unexpected id of %s", s)
+		}
+	}
+	if table.Len() != 12 {
+		t.Errorf("unexpected length %d", table.Len())
+	}
+}
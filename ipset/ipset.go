@@ -0,0 +1,137 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+// Package ipset implements an IPv4 address set on htree, IPv4 addresses
+// are exactly uint32 keys. Single addresses are kept in a htree, and CIDR
+// blocks are kept as disjoint ranges in an ordered htree, so large blocks
+// are not expanded.
+//
+// Example:
+//
+//	s := ipset.New()
+//	_, block, _ := net.ParseCIDR("10.0.0.0/8")
+//	s.AddCIDR(block)
+//	s.Add(net.ParseIP("192.168.1.1"))
+//	s.Contains(net.ParseIP("10.1.2.3")) // true
+package ipset // import "github.com/hit9/htree/ipset"
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/hit9/htree"
+)
+
+// ipRange is an inclusive range of addresses, keyed by the first one.
+type ipRange struct {
+	first, last uint32
+}
+
+// Key returns the first address of the range.
+func (r *ipRange) Key() uint32 { return r.first }
+
+// IPSet is a set of IPv4 addresses, it's not safe for concurrent use.
+type IPSet struct {
+	addrs  *htree.HTree // single addresses
+	ranges *htree.HTree // disjoint and non-adjacent ranges
+}
+
+// New creates an empty set.
+func New() *IPSet {
+	return &IPSet{
+		addrs:  htree.New(),
+		ranges: htree.New(htree.WithOrderedIndex()),
+	}
+}
+
+// key returns the address as an uint32, false if it's not IPv4.
+func key(ip net.IP) (uint32, bool) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(ip4), true
+}
+
+// Add adds the address, returns false if it's not IPv4, or the depth of
+// the htree overflows, see htree.HTree.Put.
+func (s *IPSet) Add(ip net.IP) bool {
+	k, ok := key(ip)
+	if !ok {
+		return false
+	}
+	return s.inRanges(k) || s.addrs.Put(htree.Uint32(k)) != nil
+}
+
+// AddCIDR adds the addresses of the block, returns false if it's not IPv4,
+// or the depth of the htree overflows, the set is unchanged then. The block
+// is merged with the overlapping and adjacent ones.
+func (s *IPSet) AddCIDR(block *net.IPNet) bool {
+	first, ok := key(block.IP)
+	if !ok {
+		return false
+	}
+	ones, bits := block.Mask.Size()
+	if bits != 32 {
+		return false
+	}
+	mask := ^uint32(0) << (32 - ones) // 0 for /0
+	return s.addRange(first&mask, first|^mask)
+}
+
+// addRange adds the range [first, last], merges the overlapping and
+// adjacent ranges into it. Returns false if the depth overflows.
+func (s *IPSet) addRange(first, last uint32) bool {
+	if prev := s.ranges.Floor(first); prev != nil {
+		r := prev.(*ipRange)
+		if r.last >= last {
+			return true // covered
+		}
+		if first == 0 || r.last >= first-1 {
+			first = r.first
+		}
+	}
+	hi := last
+	if hi != ^uint32(0) {
+		hi++
+	}
+	var merged []*ipRange
+	s.ranges.Range(first, hi, func(item htree.Item) bool {
+		merged = append(merged, item.(*ipRange))
+		return true
+	})
+	// Only the last one may extend the range, they are disjoint and
+	// non-adjacent.
+	if n := len(merged); n > 0 && merged[n-1].last > last {
+		last = merged[n-1].last
+	}
+	// Extend the range keyed by first in place, or put the new one before
+	// deleting the merged ones, so nothing is lost if the put fails.
+	if len(merged) > 0 && merged[0].first == first {
+		merged[0].last = last
+		merged = merged[1:]
+	} else if s.ranges.Put(&ipRange{first, last}) == nil {
+		return false
+	}
+	for _, r := range merged {
+		s.ranges.Delete(r)
+	}
+	return true
+}
+
+// inRanges reports whether the address is in a range.
+func (s *IPSet) inRanges(k uint32) bool {
+	r := s.ranges.Floor(k)
+	return r != nil && r.(*ipRange).last >= k
+}
+
+// Contains reports whether the address is in the set.
+func (s *IPSet) Contains(ip net.IP) bool {
+	k, ok := key(ip)
+	if !ok {
+		return false
+	}
+	return s.addrs.GetKey(k) != nil || s.inRanges(k)
+}
+
+// Ranges returns the number of disjoint ranges added by AddCIDR.
+func (s *IPSet) Ranges() int { return s.ranges.Len() }
@@ -0,0 +1,110 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package ipset
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func mustCIDR(s string) *net.IPNet {
+	_, block, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return block
+}
+
+// addr returns the IPv4 address of k.
+func addr(k uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, k)
+	return ip
+}
+
+func TestIPSet(t *testing.T) {
+	s := New()
+	if !s.Add(net.ParseIP("192.168.1.1")) || !s.AddCIDR(mustCIDR("10.0.0.0/8")) {
+		t.Fatal("failed to add")
+	}
+	if s.Add(net.ParseIP("::1")) || s.AddCIDR(mustCIDR("fe80::/64")) {
+		t.Fatal("added IPv6")
+	}
+	cases := map[string]bool{
+		"192.168.1.1":    true,
+		"192.168.1.2":    false,
+		"10.0.0.0":       true,
+		"10.255.255.255": true,
+		"11.0.0.0":       false,
+		"9.255.255.255":  false,
+		"::1":            false,
+	}
+	for ip, expect := range cases {
+		if s.Contains(net.ParseIP(ip)) != expect {
+			t.Errorf("contains %s: expect %v", ip, expect)
+		}
+	}
+}
+
+func TestIPSetMerge(t *testing.T) {
+	s := New()
+	s.AddCIDR(mustCIDR("10.0.1.0/24"))
+	s.AddCIDR(mustCIDR("10.0.3.0/24"))
+	if s.Ranges() != 2 {
+		t.Fatalf("unexpected ranges %d", s.Ranges())
+	}
+	// Adjacent to both.
+	s.AddCIDR(mustCIDR("10.0.2.0/24"))
+	if s.Ranges() != 1 {
+		t.Fatalf("unexpected ranges %d", s.Ranges())
+	}
+	// Covered.
+	s.AddCIDR(mustCIDR("10.0.2.128/25"))
+	// Covering.
+	s.AddCIDR(mustCIDR("10.0.0.0/16"))
+	if s.Ranges() != 1 || !s.Contains(net.ParseIP("10.0.200.1")) {
+		t.Fatalf("unexpected ranges %d", s.Ranges())
+	}
+	s.AddCIDR(mustCIDR("0.0.0.0/0"))
+	if s.Ranges() != 1 || !s.Contains(net.ParseIP("255.255.255.255")) || !s.Contains(net.ParseIP("0.0.0.0")) {
+		t.Fatal("full range not added")
+	}
+	single := New()
+	single.AddCIDR(mustCIDR("1.2.3.4/32"))
+	if !single.Contains(net.ParseIP("1.2.3.4")) || single.Contains(net.ParseIP("1.2.3.5")) {
+		t.Fatal("unexpected /32")
+	}
+}
+
+func TestIPSetCollidingRanges(t *testing.T) {
+	s := New()
+	// Starts sharing the residues of all primes overflow the tree at 10.
+	step := uint32(2 * 3 * 5 * 7 * 11 * 13 * 17 * 19 * 23)
+	for i := uint32(0); i < 9; i++ {
+		if !s.AddCIDR(&net.IPNet{IP: addr(5 + i*step), Mask: net.CIDRMask(32, 32)}) {
+			t.Fatalf("failed to add %d", i)
+		}
+	}
+	next := 6 + 9*step
+	s.AddCIDR(&net.IPNet{IP: addr(next), Mask: net.CIDRMask(32, 32)})
+	// Adjacent to next, the merged range can't be placed.
+	if s.AddCIDR(&net.IPNet{IP: addr(5 + 9*step), Mask: net.CIDRMask(32, 32)}) {
+		t.Fatal("expect overflow")
+	}
+	if s.Ranges() != 10 || !s.Contains(addr(next)) || s.Contains(addr(5+9*step)) {
+		t.Fatal("set changed on overflow")
+	}
+	// Extending a range in place never overflows.
+	if !s.AddCIDR(&net.IPNet{IP: addr(6 + 8*step), Mask: net.CIDRMask(31, 32)}) {
+		t.Fatal("failed to extend")
+	}
+	for i := uint32(0); i < 9; i++ {
+		if !s.Contains(addr(5 + i*step)) {
+			t.Errorf("lost %d", i)
+		}
+	}
+	if s.Ranges() != 10 || !s.Contains(addr(7+8*step)) {
+		t.Fatalf("unexpected ranges %d", s.Ranges())
+	}
+}
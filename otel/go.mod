@@ -0,0 +1,25 @@
+module github.com/hit9/htree/otel
+
+go 1.25.0
+
+require (
+	github.com/hit9/htree v0.0.0-20261016170014-be6cdf26fdd9
+	go.opentelemetry.io/otel v1.46.0
+	go.opentelemetry.io/otel/metric v1.46.0
+	go.opentelemetry.io/otel/sdk v1.46.0
+	go.opentelemetry.io/otel/sdk/metric v1.46.0
+	go.opentelemetry.io/otel/trace v1.46.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/go-logr/logr v1.4.4 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/auto/sdk v1.2.1 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+)
+
+// Develop against the htree in this repository, consumers of this module
+// ignore it and use the version required above.
+replace github.com/hit9/htree => ../
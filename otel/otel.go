@@ -0,0 +1,112 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+/*
+Package otel instruments htree operations with OpenTelemetry.
+
+Each Get, Put and Delete on an instrumented tree is emitted as a span named
+after the operation, e.g. "htree.get", carrying the key and the depth
+reached, and recorded into two histograms by operation:
+
+	htree.operation.duration  seconds taken by the operation
+	htree.operation.depth     levels visited on the key path
+
+Usage:
+
+	inst, err := otel.New()
+	tree := htree.New(htree.WithInstrument(inst))
+*/
+package otel // import "github.com/hit9/htree/otel"
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/hit9/htree"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name is the instrumentation scope name.
+const Name = "github.com/hit9/htree/otel"
+
+// Instrument is a htree.Instrument emitting spans and metrics. It's safe
+// for concurrent use, e.g. by the readers of the snapshots of htree.RCU.
+type Instrument struct {
+	ctx      atomic.Pointer[context.Context]
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+	depth    metric.Int64Histogram
+}
+
+// config is the configuration of an instrument.
+type config struct {
+	tp trace.TracerProvider
+	mp metric.MeterProvider
+}
+
+// Option configures an instrument on creation.
+type Option func(c *config)
+
+// WithTracerProvider sets the tracer provider, defaults to the global one.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) { c.tp = tp }
+}
+
+// WithMeterProvider sets the meter provider, defaults to the global one.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(c *config) { c.mp = mp }
+}
+
+// New creates an instrument.
+func New(opts ...Option) (*Instrument, error) {
+	c := &config{tp: otel.GetTracerProvider(), mp: otel.GetMeterProvider()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	meter := c.mp.Meter(Name)
+	duration, err := meter.Float64Histogram("htree.operation.duration",
+		metric.WithDescription("Time taken by htree operations."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	depth, err := meter.Int64Histogram("htree.operation.depth",
+		metric.WithDescription("Levels visited by htree operations."),
+		metric.WithUnit("{level}"))
+	if err != nil {
+		return nil, err
+	}
+	i := &Instrument{
+		tracer:   c.tp.Tracer(Name),
+		duration: duration,
+		depth:    depth,
+	}
+	i.SetContext(context.Background())
+	return i, nil
+}
+
+// SetContext sets the parent context of the following spans, e.g. the
+// context of the request operating the tree. The context is shared by all
+// goroutines using the instrument.
+func (i *Instrument) SetContext(ctx context.Context) { i.ctx.Store(&ctx) }
+
+// BeforeOp implements htree.Instrument, the span is emitted on AfterOp.
+func (i *Instrument) BeforeOp(op htree.Op, key uint32) {}
+
+// AfterOp implements htree.Instrument.
+func (i *Instrument) AfterOp(info htree.OpInfo) {
+	ctx := *i.ctx.Load()
+	op := attribute.String("htree.op", info.Op.String())
+	_, span := i.tracer.Start(ctx, "htree."+info.Op.String(),
+		trace.WithTimestamp(info.Start),
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(op,
+			attribute.Int64("htree.key", int64(info.Key)),
+			attribute.Int("htree.depth", info.Depth)))
+	span.End(trace.WithTimestamp(info.Start.Add(info.Duration)))
+	set := metric.WithAttributes(op)
+	i.duration.Record(ctx, info.Duration.Seconds(), set)
+	i.depth.Record(ctx, int64(info.Depth), set)
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package otel
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/hit9/htree"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestInstrument(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	inst, err := New(
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))),
+		WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := htree.New(htree.WithInstrument(inst))
+	tree.Put(htree.Uint32(0))
+	tree.Put(htree.Uint32(6))
+	tree.Get(htree.Uint32(6))
+	tree.Delete(htree.Uint32(6))
+
+	ended := spans.Ended()
+	names := []string{"htree.put", "htree.put", "htree.get", "htree.delete"}
+	if len(ended) != len(names) {
+		t.Fatalf("got %d spans, want %d", len(ended), len(names))
+	}
+	for i, span := range ended {
+		if span.Name() != names[i] {
+			t.Errorf("span %d: got name %q, want %q", i, span.Name(), names[i])
+		}
+	}
+	attrs := attribute.NewSet(ended[2].Attributes()...)
+	if v, _ := attrs.Value("htree.key"); v.AsInt64() != 6 {
+		t.Errorf("got key %v, want 6", v.AsInt64())
+	}
+	if v, _ := attrs.Value("htree.depth"); v.AsInt64() != 2 {
+		t.Errorf("got depth %v, want 2", v.AsInt64())
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]uint64{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		if m.Name != "htree.operation.depth" {
+			continue
+		}
+		for _, p := range m.Data.(metricdata.Histogram[int64]).DataPoints {
+			op, _ := p.Attributes.Value("htree.op")
+			counts[op.AsString()] = p.Count
+		}
+	}
+	if counts["put"] != 2 || counts["get"] != 1 || counts["delete"] != 1 {
+		t.Errorf("got depth counts %v", counts)
+	}
+}
+
+func TestInstrumentConcurrent(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	inst, err := New(WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := htree.NewRCU(htree.New(htree.WithInstrument(inst)))
+	r.Put(htree.Uint32(1))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				inst.SetContext(context.Background())
+				r.GetKey(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(spans.Ended()); n != 401 {
+		t.Errorf("got %d spans, want 401", n)
+	}
+}
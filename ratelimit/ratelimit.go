@@ -0,0 +1,133 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+// Package ratelimit implements per-key token bucket rate limiting on htree,
+// e.g. limiting the requests of each user. The buckets of the keys idle for
+// a while are removed, so the memory is bounded by the active keys.
+//
+// Example:
+//
+//	l := ratelimit.New(10, 20, time.Minute) // 10 per second, bursts of 20
+//	if !l.Allow(userID) {
+//		return errTooManyRequests
+//	}
+package ratelimit // import "github.com/hit9/htree/ratelimit"
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hit9/htree"
+)
+
+// bucket is the token bucket of a key.
+type bucket struct {
+	key    uint32
+	tokens float64
+	last   int64 // unix nanoseconds of the last refill
+}
+
+// Key returns the bucket key.
+func (b *bucket) Key() uint32 { return b.key }
+
+// Limiter limits the rate of events per key, safe for concurrent use.
+type Limiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per nanosecond
+	burst   float64
+	ttl     int64       // nanoseconds
+	clock   htree.Clock // nil for the system clock
+	buckets *htree.Overflow
+	sweep   int64 // unix nanoseconds of the next cleanup
+}
+
+// Option configures a limiter on creation.
+type Option func(l *Limiter)
+
+// WithClock sets the time source of the limiter, the system clock by
+// default.
+func WithClock(c htree.Clock) Option {
+	return func(l *Limiter) { l.clock = c }
+}
+
+// New creates a limiter allowing rate events per second for each key, with
+// bursts of at most burst events. The buckets idle for ttl are removed, a
+// removed bucket is the same as a full one if ttl is not shorter than
+// burst/rate seconds, otherwise the limits of the keys returning in between
+// are relaxed.
+func New(rate float64, burst int, ttl time.Duration, opts ...Option) *Limiter {
+	l := &Limiter{
+		rate:    rate / float64(time.Second),
+		burst:   float64(burst),
+		ttl:     int64(ttl),
+		buckets: htree.NewOverflow(),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.sweep = l.now() + l.ttl
+	return l
+}
+
+// now returns the current unix nanoseconds by the clock.
+func (l *Limiter) now() int64 {
+	if l.clock == nil {
+		return time.Now().UnixNano()
+	}
+	return l.clock.Now().UnixNano()
+}
+
+// Allow reports whether an event of the key may happen now, and takes a
+// token from its bucket if so.
+func (l *Limiter) Allow(key uint32) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now >= l.sweep {
+		l.cleanup(now)
+	}
+	item := l.buckets.Get(key)
+	if item == nil {
+		item = l.buckets.Put(&bucket{key, l.burst, now})
+	}
+	b := item.(*bucket)
+	b.tokens += float64(now-b.last) * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Len returns the number of buckets.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buckets.Len()
+}
+
+// Cleanup removes the buckets idle for ttl. It's called by Allow once per
+// ttl, so it's rarely needed to call it explicitly.
+func (l *Limiter) Cleanup() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cleanup(l.now())
+}
+
+// cleanup removes the idle buckets, it must be called with the lock held.
+func (l *Limiter) cleanup(now int64) {
+	var idle []uint32
+	l.buckets.Walk(func(item htree.Item) bool {
+		if b := item.(*bucket); now-b.last >= l.ttl {
+			idle = append(idle, b.key)
+		}
+		return true
+	})
+	for _, key := range idle {
+		l.buckets.Delete(key)
+	}
+	l.sweep = now + l.ttl
+}
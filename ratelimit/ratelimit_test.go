@@ -0,0 +1,81 @@
+// Copyright 2016 Chao Wang <hit9@icloud.com>.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock set by tests.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestAllow(t *testing.T) {
+	clock := &fakeClock{time.Unix(100, 0)}
+	l := New(2, 3, time.Minute, WithClock(clock))
+	for i := 0; i < 3; i++ {
+		if !l.Allow(1) {
+			t.Fatalf("event %d not allowed", i)
+		}
+	}
+	if l.Allow(1) {
+		t.Fatal("burst exceeded")
+	}
+	if !l.Allow(2) {
+		t.Fatal("keys not limited separately")
+	}
+	// 2 tokens per second.
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	if !l.Allow(1) || l.Allow(1) {
+		t.Fatal("unexpected refill")
+	}
+	// Refills up to the burst.
+	clock.now = clock.now.Add(time.Hour)
+	if l.Len() != 2 {
+		t.Fatalf("unexpected length %d", l.Len())
+	}
+	for i := 0; i < 3; i++ {
+		if !l.Allow(1) {
+			t.Fatalf("event %d not allowed", i)
+		}
+	}
+	if l.Allow(1) {
+		t.Fatal("burst exceeded")
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	clock := &fakeClock{time.Unix(100, 0)}
+	l := New(1, 1, time.Minute, WithClock(clock))
+	l.Allow(1)
+	l.Allow(2)
+	clock.now = clock.now.Add(30 * time.Second)
+	l.Allow(2)
+	clock.now = clock.now.Add(40 * time.Second)
+	// Sweeps the idle key 1 on the way.
+	l.Allow(3)
+	if l.Len() != 2 {
+		t.Fatalf("unexpected length %d", l.Len())
+	}
+	clock.now = clock.now.Add(time.Minute)
+	l.Cleanup()
+	if l.Len() != 0 {
+		t.Fatalf("unexpected length %d", l.Len())
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	l := New(1, 1, time.Minute)
+	// Keys sharing all the remainders of the first 9 primes.
+	step := uint32(2 * 3 * 5 * 7 * 11 * 13 * 17 * 19 * 23)
+	for i := uint32(0); i < 12; i++ {
+		if !l.Allow(i * step) {
+			t.Fatalf("key %d not allowed", i*step)
+		}
+	}
+	if l.Allow(11*step) || l.Len() != 12 {
+		t.Fatal("overflowed key not limited")
+	}
+}